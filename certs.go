@@ -0,0 +1,126 @@
+/*
+Copyright 2023 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package function
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The files from which mTLS certificates are loaded.
+var certFiles = []string{"tls.crt", "tls.key", "ca.crt"}
+
+// loadTLSConfig loads an mTLS server config from the supplied directory. The
+// directory must contain the server certificate (tls.key and tls.crt), as well
+// as a CA certificate (ca.crt) that will be used to authenticate clients.
+func loadTLSConfig(dir string) (*tls.Config, error) {
+	crt, err := tls.LoadX509KeyPair(
+		filepath.Clean(filepath.Join(dir, "tls.crt")),
+		filepath.Clean(filepath.Join(dir, "tls.key")),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot load X509 keypair")
+	}
+
+	ca, err := os.ReadFile(filepath.Clean(filepath.Join(dir, "ca.crt")))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read CA certificate")
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("invalid CA certificate")
+	}
+
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{crt},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		NextProtos:   []string{"h2"},
+	}, nil
+}
+
+// A certWatcher serves an mTLS server config loaded from a directory,
+// reloading it when the files in the directory change.
+//
+// It checks the files' modification times rather than watching for filesystem
+// events. Kubernetes updates mounted Secrets by atomically swapping a symlink,
+// which is easy to miss when watching for events, but always changes the
+// modification times of the files the symlinks resolve to.
+type certWatcher struct {
+	dir string
+
+	mu      sync.Mutex
+	cfg     *tls.Config
+	modTime time.Time
+}
+
+func newCertWatcher(dir string) (*certWatcher, error) {
+	mt, err := latestModTime(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot stat certificates")
+	}
+	cfg, err := loadTLSConfig(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &certWatcher{dir: dir, cfg: cfg, modTime: mt}, nil
+}
+
+// GetConfigForClient returns the current mTLS server config, reloading it if
+// the certificates have changed since they were last loaded. It returns the
+// previous config if the certificates can't be reloaded.
+func (w *certWatcher) GetConfigForClient(_ *tls.ClientHelloInfo) (*tls.Config, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	mt, err := latestModTime(w.dir)
+	if err != nil || !mt.After(w.modTime) {
+		return w.cfg, nil
+	}
+	cfg, err := loadTLSConfig(w.dir)
+	if err != nil {
+		// The certificates may be only partially written. We'll try again
+		// when the next client connects.
+		return w.cfg, nil
+	}
+	w.cfg, w.modTime = cfg, mt
+	return w.cfg, nil
+}
+
+// latestModTime returns the latest modification time of the certificate files
+// in the supplied directory.
+func latestModTime(dir string) (time.Time, error) {
+	var latest time.Time
+	for _, f := range certFiles {
+		fi, err := os.Stat(filepath.Join(dir, f))
+		if err != nil {
+			return time.Time{}, err
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2023 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package function
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// writeCerts writes a self-signed certificate with the supplied common name to
+// tls.crt, tls.key, and ca.crt in the supplied directory, with the supplied
+// modification time.
+func writeCerts(t *testing.T, dir, cn string, mt time.Time) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey(...): %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("x509.CreateCertificate(...): %v", err)
+	}
+	kder, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("x509.MarshalECPrivateKey(...): %v", err)
+	}
+
+	crt := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	files := map[string][]byte{
+		"tls.crt": crt,
+		"tls.key": pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kder}),
+		"ca.crt":  crt,
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatalf("os.WriteFile(...): %v", err)
+		}
+		if err := os.Chtimes(path, mt, mt); err != nil {
+			t.Fatalf("os.Chtimes(...): %v", err)
+		}
+	}
+}
+
+func TestCertWatcher(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	if _, err := newCertWatcher(dir); err == nil {
+		t.Errorf("newCertWatcher(...): expected an error when there are no certificates")
+	}
+
+	writeCerts(t, dir, "first", now)
+	w, err := newCertWatcher(dir)
+	if err != nil {
+		t.Fatalf("newCertWatcher(...): unexpected error: %v", err)
+	}
+
+	commonName := func() string {
+		t.Helper()
+		cfg, err := w.GetConfigForClient(&tls.ClientHelloInfo{})
+		if err != nil {
+			t.Fatalf("GetConfigForClient(...): unexpected error: %v", err)
+		}
+		c, err := x509.ParseCertificate(cfg.Certificates[0].Certificate[0])
+		if err != nil {
+			t.Fatalf("x509.ParseCertificate(...): unexpected error: %v", err)
+		}
+		return c.Subject.CommonName
+	}
+
+	if diff := cmp.Diff("first", commonName()); diff != "" {
+		t.Errorf("GetConfigForClient(...): -want, +got:\n%s", diff)
+	}
+
+	writeCerts(t, dir, "second", now.Add(time.Minute))
+	if diff := cmp.Diff("second", commonName()); diff != "" {
+		t.Errorf("GetConfigForClient(...): rotated certificates should be reloaded: -want, +got:\n%s", diff)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "tls.key")); err != nil {
+		t.Fatalf("os.Remove(...): %v", err)
+	}
+	if diff := cmp.Diff("second", commonName()); diff != "" {
+		t.Errorf("GetConfigForClient(...): missing certificates should fall back to the previous ones: -want, +got:\n%s", diff)
+	}
+}
+
+func TestWithCertWatcher(t *testing.T) {
+	o := &ServeOptions{}
+	if err := WithCertWatcher("")(o); err != nil {
+		t.Errorf("WithCertWatcher(\"\"): unexpected error: %v", err)
+	}
+	if o.Credentials != nil {
+		t.Errorf("WithCertWatcher(\"\"): should not set credentials")
+	}
+
+	dir := t.TempDir()
+	writeCerts(t, dir, "cool", time.Now())
+	if err := WithCertWatcher(dir)(o); err != nil {
+		t.Fatalf("WithCertWatcher(...): unexpected error: %v", err)
+	}
+	if o.Credentials == nil {
+		t.Errorf("WithCertWatcher(...): should set credentials")
+	}
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2023 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package function
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+
+	"github.com/crossplane/function-sdk-go/logging"
+	"github.com/crossplane/function-sdk-go/proto/v1beta1"
+)
+
+type ctxKey struct{}
+
+// A Context carries metadata scoped to a single RunFunctionRequest. Serve
+// injects a Context into the context.Context passed to RunFunction. Use CtxFrom
+// to retrieve it.
+type Context struct {
+	context.Context
+
+	// Tag of the RunFunctionRequest.
+	Tag string
+
+	// Log is a logger with the request's tag as a key-value pair.
+	Log logging.Logger
+}
+
+// WithCtx returns a copy of the supplied context.Context that carries the
+// supplied Context. This is useful to test Functions that use CtxFrom.
+func WithCtx(ctx context.Context, c *Context) context.Context {
+	return context.WithValue(ctx, ctxKey{}, c)
+}
+
+// CtxFrom returns the Context carried by the supplied context.Context. It
+// returns a usable Context with an empty tag and a no-op logger if the supplied
+// context.Context doesn't carry one.
+func CtxFrom(ctx context.Context) *Context {
+	c, ok := ctx.Value(ctxKey{}).(*Context)
+	if !ok {
+		return &Context{Context: ctx, Log: logging.NewNopLogger()}
+	}
+	return &Context{Context: ctx, Tag: c.Tag, Log: c.Log}
+}
+
+// Remaining returns how long remains until the Context's deadline. It returns
+// false if the Context has no deadline.
+func (c *Context) Remaining() (time.Duration, bool) {
+	d, ok := c.Deadline()
+	if !ok {
+		return 0, false
+	}
+	return time.Until(d), true
+}
+
+// A Caller identifies the client that sent a RunFunctionRequest - usually
+// Crossplane.
+type Caller struct {
+	// Address is the network address of the client.
+	Address string
+
+	// CommonName is the common name of the client's mTLS certificate. It's
+	// empty if the Function is served insecurely.
+	CommonName string
+}
+
+// CallerFrom returns the Caller that sent the RunFunctionRequest being handled
+// using the supplied context.Context, for example to record it in an audit log.
+// RunFunctionRequests don't identify their caller, so the Caller is derived from
+// the gRPC connection. It returns false if the context.Context doesn't carry
+// connection information.
+func CallerFrom(ctx context.Context) (Caller, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return Caller{}, false
+	}
+	c := Caller{}
+	if p.Addr != nil {
+		c.Address = p.Addr.String()
+	}
+	if ti, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(ti.State.PeerCertificates) > 0 {
+		c.CommonName = ti.State.PeerCertificates[0].Subject.CommonName
+	}
+	return c, true
+}
+
+// requestContext returns a gRPC interceptor that injects a Context into the
+// context.Context passed to RunFunction.
+func requestContext(log logging.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		freq, ok := req.(*v1beta1.RunFunctionRequest)
+		if !ok {
+			return handler(ctx, req)
+		}
+		tag := freq.GetMeta().GetTag()
+		return handler(WithCtx(ctx, &Context{Tag: tag, Log: log.WithValues("tag", tag)}), req)
+	}
+}
@@ -28,4 +28,24 @@ const (
 	// unless the relevant Crossplane feature flag is enabled, and may be
 	// changed or removed without notice.
 	KeyEnvironment = "apiextensions.crossplane.io/environment"
+
+	// KeyResultData is the context key under which the SDK records structured
+	// data attached to results, until results support structured data. Its
+	// value is a list of objects, each with a message and data field.
+	KeyResultData = "function-sdk-go.crossplane.io/result-data"
+
+	// KeyProgress is the context key under which the SDK records the progress
+	// of a multi-step operation. Its value is an object with step, total, and
+	// message fields.
+	KeyProgress = "function-sdk-go.crossplane.io/progress"
+
+	// KeyDebug is the context key under which the SDK records debugging
+	// artifacts. Its value is an object keyed by artifact name. The SDK strips
+	// it from responses unless the Function is served with debugging enabled.
+	KeyDebug = "function-sdk-go.crossplane.io/debug"
+
+	// KeyRender is the context key that tells a Function it's being run by
+	// crossplane beta render, rather than by Crossplane. Crossplane never sets
+	// it. Set it to true when rendering using the --context-values flag.
+	KeyRender = "function-sdk-go.crossplane.io/render"
 )
@@ -0,0 +1,67 @@
+/*
+Copyright 2023 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package function
+
+import (
+	"context"
+	"net/http"
+
+	"connectrpc.com/connect"
+	"github.com/pkg/errors"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/crossplane/function-sdk-go/logging"
+	"github.com/crossplane/function-sdk-go/proto/v1beta1"
+)
+
+// NewHTTPHandler returns an http.Handler that serves the supplied Function's
+// RunFunction RPC using the Connect, gRPC, and gRPC-Web protocols, over
+// HTTP/1.1 or HTTP/2 - including HTTP/2 without TLS. Use it to run a Function
+// behind an HTTP gateway, or on a platform that only supports HTTP. Crossplane
+// itself calls Functions using gRPC, so most Functions should use Serve instead.
+//
+// Like Serve, the handler converts errors to status codes, makes the
+// request-scoped Context available via CtxFrom, and strips debugging artifacts
+// from responses. The handler doesn't support any ServeOptions, so the Context's
+// logger is a no-op logger.
+func NewHTTPHandler(fn v1beta1.FunctionRunnerServiceServer) http.Handler {
+	info := &grpc.UnaryServerInfo{Server: fn, FullMethod: v1beta1.FunctionRunnerService_RunFunction_FullMethodName}
+	run := func(ctx context.Context, req any) (any, error) {
+		return fn.RunFunction(ctx, req.(*v1beta1.RunFunctionRequest)) //nolint:forcetypeassert // We always pass a *v1beta1.RunFunctionRequest.
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(v1beta1.FunctionRunnerService_RunFunction_FullMethodName, connect.NewUnaryHandler(
+		v1beta1.FunctionRunnerService_RunFunction_FullMethodName,
+		func(ctx context.Context, req *connect.Request[v1beta1.RunFunctionRequest]) (*connect.Response[v1beta1.RunFunctionResponse], error) {
+			rsp, err := statusErrors(ctx, req.Msg, info, func(ctx context.Context, req any) (any, error) {
+				return requestContext(logging.NewNopLogger())(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+					return stripDebug(ctx, req, info, run)
+				})
+			})
+			if err != nil {
+				s := status.Convert(err)
+				return nil, connect.NewError(connect.Code(s.Code()), errors.New(s.Message()))
+			}
+			return connect.NewResponse(rsp.(*v1beta1.RunFunctionResponse)), nil //nolint:forcetypeassert // RunFunction always returns a *v1beta1.RunFunctionResponse.
+		},
+	))
+	return h2c.NewHandler(mux, &http2.Server{})
+}
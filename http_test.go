@@ -0,0 +1,110 @@
+/*
+Copyright 2023 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package function
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+
+	"github.com/crossplane/function-sdk-go/proto/v1beta1"
+)
+
+type broken struct {
+	v1beta1.UnimplementedFunctionRunnerServiceServer
+}
+
+func (b *broken) RunFunction(_ context.Context, _ *v1beta1.RunFunctionRequest) (*v1beta1.RunFunctionResponse, error) {
+	return nil, StatusError(codes.Unavailable, errors.New("dependency unavailable"))
+}
+
+// ctxEcho responds with the tag available via CtxFrom, rather than the tag of
+// the request.
+type ctxEcho struct {
+	v1beta1.UnimplementedFunctionRunnerServiceServer
+}
+
+func (e *ctxEcho) RunFunction(ctx context.Context, _ *v1beta1.RunFunctionRequest) (*v1beta1.RunFunctionResponse, error) {
+	return &v1beta1.RunFunctionResponse{Meta: &v1beta1.ResponseMeta{Tag: CtxFrom(ctx).Tag}}, nil
+}
+
+func TestNewHTTPHandler(t *testing.T) {
+	type want struct {
+		tag  string
+		code connect.Code
+	}
+
+	cases := map[string]struct {
+		reason string
+		fn     v1beta1.FunctionRunnerServiceServer
+		opts   []connect.ClientOption
+		want   want
+	}{
+		"Connect": {
+			reason: "We should serve RunFunction using the Connect protocol.",
+			fn:     &echo{},
+			want:   want{tag: "cool-tag"},
+		},
+		"GRPCWeb": {
+			reason: "We should serve RunFunction using the gRPC-Web protocol.",
+			fn:     &echo{},
+			opts:   []connect.ClientOption{connect.WithGRPCWeb()},
+			want:   want{tag: "cool-tag"},
+		},
+		"RequestContext": {
+			reason: "We should make the request-scoped Context available via CtxFrom.",
+			fn:     &ctxEcho{},
+			want:   want{tag: "cool-tag"},
+		},
+		"StatusError": {
+			reason: "We should return errors with the status code the Function returned.",
+			fn:     &broken{},
+			want:   want{code: connect.CodeUnavailable},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(NewHTTPHandler(tc.fn))
+			defer srv.Close()
+
+			c := connect.NewClient[v1beta1.RunFunctionRequest, v1beta1.RunFunctionResponse](
+				http.DefaultClient,
+				srv.URL+v1beta1.FunctionRunnerService_RunFunction_FullMethodName,
+				tc.opts...,
+			)
+			req := &v1beta1.RunFunctionRequest{Meta: &v1beta1.RequestMeta{Tag: "cool-tag"}}
+			rsp, err := c.CallUnary(context.Background(), connect.NewRequest(req))
+
+			got := want{}
+			if err != nil {
+				got.code = connect.CodeOf(err)
+			} else {
+				got.tag = rsp.Msg.GetMeta().GetTag()
+			}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("\n%s\nRunFunction(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
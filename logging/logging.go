@@ -24,6 +24,7 @@ import (
 	"github.com/go-logr/logr"
 	"github.com/go-logr/zapr"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 
 	"github.com/crossplane/crossplane-runtime/pkg/logging"
 
@@ -43,13 +44,62 @@ func NewLogrLogger(l logr.Logger) Logger {
 	return logging.NewLogrLogger(l)
 }
 
-// NewLogger returns a new logger.
-func NewLogger(debug bool) (logging.Logger, error) {
-	o := []zap.Option{zap.AddCallerSkip(1)}
-	if debug {
-		zl, err := zap.NewDevelopment(o...)
-		return NewLogrLogger(zapr.NewLogger(zl)), errors.Wrap(err, "cannot create development zap logger")
+// An Option configures a Logger returned by NewLogger.
+type Option func(o *options)
+
+type options struct {
+	console bool
+	level   int
+}
+
+// JSON configures the logger to emit structured JSON, suitable for production
+// log pipelines. This is the default.
+func JSON() Option {
+	return func(o *options) {
+		o.console = false
+	}
+}
+
+// Console configures the logger to emit human-readable console output,
+// suitable for local development.
+func Console() Option {
+	return func(o *options) {
+		o.console = true
+	}
+}
+
+// Level configures the verbosity of the logger. Messages logged at V(v) or
+// lower are emitted. Debug messages are logged at V(1), so Level(1) enables
+// them. The default is 0.
+func Level(v int) Option {
+	return func(o *options) {
+		o.level = v
+	}
+}
+
+// NewLogger returns a new logger. By default it emits structured JSON, and
+// does not emit debug messages.
+func NewLogger(o ...Option) (Logger, error) {
+	zl, err := newConfig(o...).Build(zap.AddCallerSkip(1))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create zap logger")
+	}
+	return NewLogrLogger(zapr.NewLogger(zl)), nil
+}
+
+// newConfig returns the zap config for a logger with the supplied options.
+// Zap levels decrease as logr verbosity increases, so V(v) maps to zap level
+// -v.
+func newConfig(o ...Option) zap.Config {
+	opts := &options{}
+	for _, fn := range o {
+		fn(opts)
+	}
+
+	cfg := zap.NewProductionConfig()
+	if opts.console {
+		cfg = zap.NewDevelopmentConfig()
 	}
-	zl, err := zap.NewProduction(o...)
-	return NewLogrLogger(zapr.NewLogger(zl)), errors.Wrap(err, "cannot create production zap logger")
+	cfg.Level = zap.NewAtomicLevelAt(zapcore.Level(-opts.level))
+	return cfg
 }
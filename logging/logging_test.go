@@ -0,0 +1,89 @@
+/*
+Copyright 2023 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logging
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestNewConfig(t *testing.T) {
+	type want struct {
+		encoding string
+		level    zapcore.Level
+		info     bool
+		debug    bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		o      []Option
+		want   want
+	}{
+		"Default": {
+			reason: "By default we should emit JSON at info level, without debug messages.",
+			want:   want{encoding: "json", level: zapcore.InfoLevel, info: true},
+		},
+		"Console": {
+			reason: "The Console option should emit human-readable console output.",
+			o:      []Option{Console()},
+			want:   want{encoding: "console", level: zapcore.InfoLevel, info: true},
+		},
+		"JSON": {
+			reason: "The JSON option should override an earlier Console option.",
+			o:      []Option{Console(), JSON()},
+			want:   want{encoding: "json", level: zapcore.InfoLevel, info: true},
+		},
+		"LevelOne": {
+			reason: "Level(1) should map to zap level -1, enabling debug messages.",
+			o:      []Option{Level(1)},
+			want:   want{encoding: "json", level: zapcore.DebugLevel, info: true, debug: true},
+		},
+		"LevelTwo": {
+			reason: "Level(2) should map to zap level -2, enabling messages at V(2) and lower.",
+			o:      []Option{Level(2)},
+			want:   want{encoding: "json", level: zapcore.Level(-2), info: true, debug: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cfg := newConfig(tc.o...)
+			got := want{
+				encoding: cfg.Encoding,
+				level:    cfg.Level.Level(),
+				info:     cfg.Level.Enabled(zapcore.InfoLevel),
+				debug:    cfg.Level.Enabled(zapcore.DebugLevel),
+			}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("\n%s\nnewConfig(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	l, err := NewLogger(Console(), Level(1))
+	if err != nil {
+		t.Fatalf("NewLogger(...): unexpected error: %v", err)
+	}
+	if l == nil {
+		t.Errorf("NewLogger(...): want a logger, got nil")
+	}
+}
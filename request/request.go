@@ -18,15 +18,31 @@ limitations under the License.
 package request
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/types/known/structpb"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/validation"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
 
+	fncontext "github.com/crossplane/function-sdk-go/context"
 	"github.com/crossplane/function-sdk-go/errors"
 	"github.com/crossplane/function-sdk-go/proto/v1beta1"
 	"github.com/crossplane/function-sdk-go/resource"
 	"github.com/crossplane/function-sdk-go/resource/composed"
 	"github.com/crossplane/function-sdk-go/resource/composite"
+	"github.com/crossplane/function-sdk-go/response"
 )
 
 // GetInput from the supplied request. Input is loaded into the supplied object.
@@ -34,6 +50,158 @@ func GetInput(req *v1beta1.RunFunctionRequest, into runtime.Object) error {
 	return errors.Wrap(resource.AsObject(req.GetInput(), into), "cannot get Function input %T from %T, into, req")
 }
 
+// GetInputMerged loads the supplied defaults, overridden by the input of the
+// supplied request, into the supplied object. Objects are merged field by
+// field, so the input only needs to specify the fields it overrides. Any other
+// value in the input, including a zero value like false or an empty string,
+// replaces the corresponding default. Fields that are absent from the input
+// keep their default value.
+func GetInputMerged(req *v1beta1.RunFunctionRequest, defaults, into runtime.Object) error {
+	d, err := resource.AsStruct(defaults)
+	if err != nil {
+		return errors.Wrapf(err, "cannot convert default Function input %T", defaults)
+	}
+	merged, err := structpb.NewStruct(mergeInput(d.AsMap(), req.GetInput().AsMap()))
+	if err != nil {
+		return errors.Wrap(err, "cannot convert merged Function input")
+	}
+	return errors.Wrapf(resource.AsObject(merged, into), "cannot get merged Function input %T", into)
+}
+
+// mergeInput deep merges the supplied overrides into the supplied defaults.
+func mergeInput(defaults, overrides map[string]any) map[string]any {
+	for k, ov := range overrides {
+		om, ook := ov.(map[string]any)
+		dm, dok := defaults[k].(map[string]any)
+		if ook && dok {
+			defaults[k] = mergeInput(dm, om)
+			continue
+		}
+		defaults[k] = ov
+	}
+	return defaults
+}
+
+// An InputCodec decodes a Function's input. Input is always sent to a Function
+// as a protobuf struct, so a codec for a non-JSON encoding typically decodes a
+// string field of the struct, for example one containing base64 encoded CBOR.
+type InputCodec interface {
+	Decode(input *structpb.Struct, into any) error
+}
+
+// An InputCodecFn is a function that satisfies InputCodec.
+type InputCodecFn func(input *structpb.Struct, into any) error
+
+// Decode the supplied input into the supplied value.
+func (fn InputCodecFn) Decode(input *structpb.Struct, into any) error {
+	return fn(input, into)
+}
+
+// JSONInputCodec decodes input by round-tripping it through JSON. It's
+// equivalent to GetInput, but can decode into any Go value.
+var JSONInputCodec InputCodec = InputCodecFn(func(input *structpb.Struct, into any) error {
+	b, err := protojson.Marshal(input)
+	if err != nil {
+		return errors.Wrapf(err, "cannot marshal %T to JSON", input)
+	}
+	return errors.Wrapf(json.Unmarshal(b, into), "cannot unmarshal JSON from %T into %T", input, into)
+})
+
+// GetInputWith decodes the input of the supplied request into the supplied
+// value using the supplied codec.
+func GetInputWith(req *v1beta1.RunFunctionRequest, codec InputCodec, into any) error {
+	return errors.Wrapf(codec.Decode(req.GetInput(), into), "cannot get Function input %T", into)
+}
+
+// GetInputRaw returns the input of the supplied request encoded as JSON. Use
+// it to parse input that can't be loaded into a runtime.Object. It returns an
+// error if the request has no input.
+func GetInputRaw(req *v1beta1.RunFunctionRequest) ([]byte, error) {
+	if req.GetInput() == nil {
+		return nil, errors.New("request has no input")
+	}
+	b, err := protojson.Marshal(req.GetInput())
+	return b, errors.Wrap(err, "cannot marshal input to JSON")
+}
+
+// GetInputField loads the value at the supplied field path of the supplied
+// request's input into the supplied Go value. Use it to read a single field
+// without decoding the entire input. It returns true if the field was loaded.
+// It returns false if the field path doesn't exist, and false and an error if
+// the field path is invalid or its value can't be loaded into the supplied Go
+// value.
+func GetInputField(req *v1beta1.RunFunctionRequest, path string, into any) (bool, error) {
+	err := fieldpath.Pave(req.GetInput().AsMap()).GetValueInto(path, into)
+	if fieldpath.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "cannot get input field %q", path)
+	}
+	return true, nil
+}
+
+// GetInputTTL returns the duration string (e.g. "30s") at the supplied field
+// path of the supplied request's input, parsed as a TTL. Use it to let users
+// configure how long a response may be cached - see response.To. It returns the
+// supplied default if the field path doesn't exist, and an error if its value
+// isn't a valid, non-negative duration.
+func GetInputTTL(req *v1beta1.RunFunctionRequest, path string, def time.Duration) (time.Duration, error) {
+	var s string
+	ok, err := GetInputField(req, path, &s)
+	if err != nil {
+		return 0, errors.Wrapf(err, "cannot get TTL from input field %q", path)
+	}
+	if !ok {
+		return def, nil
+	}
+	ttl, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, errors.Wrapf(err, "cannot parse TTL from input field %q", path)
+	}
+	if ttl < 0 {
+		return 0, errors.Errorf("TTL from input field %q must not be negative, got %s", path, ttl)
+	}
+	return ttl, nil
+}
+
+// WarnDeprecatedInput adds a warning result to the supplied response for each
+// deprecated field path that is set in the supplied request's input. The
+// supplied map of deprecated field paths to guidance, e.g. "use spec.size
+// instead", is included in each warning. Fields that aren't set are ignored. It
+// returns an error if a field path is invalid.
+func WarnDeprecatedInput(req *v1beta1.RunFunctionRequest, rsp *v1beta1.RunFunctionResponse, deprecated map[string]string) error {
+	paths := make([]string, 0, len(deprecated))
+	for path := range deprecated {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	p := fieldpath.Pave(req.GetInput().AsMap())
+	for _, path := range paths {
+		_, err := p.GetValue(path)
+		if fieldpath.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "cannot get input field %q", path)
+		}
+		response.Warning(rsp, errors.Errorf("input field %q is deprecated: %s", path, deprecated[path]))
+	}
+	return nil
+}
+
+// ValidateInput validates the input of the supplied request against the
+// supplied OpenAPI schema, returning any validation errors. Use
+// response.FromFieldErrors to return them to the user.
+func ValidateInput(req *v1beta1.RunFunctionRequest, schema *apiextensions.JSONSchemaProps) field.ErrorList {
+	v, _, err := validation.NewSchemaValidator(schema)
+	if err != nil {
+		return field.ErrorList{field.InternalError(nil, errors.Wrap(err, "cannot create input schema validator"))}
+	}
+	return validation.ValidateCustomResource(nil, req.GetInput().AsMap(), v)
+}
+
 // GetContextKey gets context from the supplied key.
 func GetContextKey(req *v1beta1.RunFunctionRequest, key string) (*structpb.Value, bool) {
 	f := req.GetContext().GetFields()
@@ -44,6 +212,85 @@ func GetContextKey(req *v1beta1.RunFunctionRequest, key string) (*structpb.Value
 	return v, ok
 }
 
+// GetContextBytes gets bytes from the supplied context key. The bytes must be
+// encoded as a string using standard, padded base64 encoding (RFC 4648), as
+// done by response.SetContextBytes. It returns false if the key isn't set.
+func GetContextBytes(req *v1beta1.RunFunctionRequest, key string) ([]byte, bool, error) {
+	v, ok := GetContextKey(req, key)
+	if !ok {
+		return nil, false, nil
+	}
+	s, ok := v.GetKind().(*structpb.Value_StringValue)
+	if !ok {
+		return nil, true, errors.Errorf("context key %q is not a string", key)
+	}
+	b, err := base64.StdEncoding.DecodeString(s.StringValue)
+	if err != nil {
+		return nil, true, errors.Wrapf(err, "cannot decode base64 context key %q", key)
+	}
+	return b, true, nil
+}
+
+// GetContextObjectOrDefault loads the value of the supplied context key into
+// the supplied object. If the key isn't set, for example because an earlier
+// Function in the pipeline didn't run or didn't set it, the supplied default is
+// loaded into the object instead. It returns an error if the value isn't an
+// object that can be decoded into the supplied object.
+func GetContextObjectOrDefault(req *v1beta1.RunFunctionRequest, key string, into, def runtime.Object) error {
+	v, ok := GetContextKey(req, key)
+	if !ok {
+		s, err := resource.AsStruct(def)
+		if err != nil {
+			return errors.Wrapf(err, "cannot convert default for context key %q", key)
+		}
+		return errors.Wrapf(resource.AsObject(s, into), "cannot load default for context key %q into %T", key, into)
+	}
+	s, ok := v.GetKind().(*structpb.Value_StructValue)
+	if !ok {
+		return errors.Errorf("context key %q is not an object", key)
+	}
+	return errors.Wrapf(resource.AsObject(s.StructValue, into), "cannot load context key %q into %T", key, into)
+}
+
+// GetEnvironment returns the Composition Environment from the supplied
+// request's context. It returns an empty environment if the context doesn't
+// contain one. Use response.SetEnvironment to update it.
+func GetEnvironment(req *v1beta1.RunFunctionRequest) (*unstructured.Unstructured, error) {
+	env := &unstructured.Unstructured{Object: map[string]any{}}
+	v, ok := GetContextKey(req, fncontext.KeyEnvironment)
+	if !ok {
+		return env, nil
+	}
+	s, ok := v.GetKind().(*structpb.Value_StructValue)
+	if !ok {
+		return nil, errors.Errorf("context key %q is not an object", fncontext.KeyEnvironment)
+	}
+	return env, errors.Wrap(resource.AsObject(s.StructValue, env), "cannot get environment")
+}
+
+// IsRenderMode returns true if the supplied request's context key
+// fncontext.KeyRender is true, indicating that the Function is being run
+// locally by crossplane beta render. Use it to adjust behavior for local
+// development, for example to avoid calling external systems. Requests don't
+// otherwise say what sent them, so the key must be set explicitly, e.g.:
+//
+//	crossplane beta render --context-values=function-sdk-go.crossplane.io/render=true ...
+//
+// It returns false if the key isn't set, or isn't a boolean.
+func IsRenderMode(req *v1beta1.RunFunctionRequest) bool {
+	v, ok := GetContextKey(req, fncontext.KeyRender)
+	return ok && v.GetBoolValue()
+}
+
+// GetDeadline returns the deadline by which the Function must respond to the
+// supplied request, as propagated by Crossplane via the supplied context. A
+// Function may use it to budget calls to external services. It returns false
+// if there is no deadline. RunFunctionRequests don't currently carry a deadline
+// of their own, so the request doesn't affect the deadline.
+func GetDeadline(ctx context.Context, _ *v1beta1.RunFunctionRequest) (time.Time, bool) {
+	return ctx.Deadline()
+}
+
 // GetObservedCompositeResource from the supplied request.
 func GetObservedCompositeResource(req *v1beta1.RunFunctionRequest) (*resource.Composite, error) {
 	xr := &resource.Composite{
@@ -59,17 +306,49 @@ func GetObservedCompositeResource(req *v1beta1.RunFunctionRequest) (*resource.Co
 	return xr, err
 }
 
+// RequireCompositeKind returns an error if the observed composite resource in
+// the supplied request isn't one of the allowed kinds. It also returns an error
+// if the request has no observed composite resource.
+func RequireCompositeKind(req *v1beta1.RunFunctionRequest, allowed ...schema.GroupVersionKind) error {
+	if req.GetObserved().GetComposite().GetResource() == nil {
+		return errors.New("request has no observed composite resource")
+	}
+	xr, err := GetObservedCompositeResource(req)
+	if err != nil {
+		return errors.Wrap(err, "cannot get observed composite resource")
+	}
+	gvk := xr.Resource.GroupVersionKind()
+	for _, a := range allowed {
+		if gvk == a {
+			return nil
+		}
+	}
+	s := make([]string, len(allowed))
+	for i, a := range allowed {
+		s[i] = a.String()
+	}
+	return errors.Errorf("unsupported composite resource kind %q - must be one of [%s]", gvk, strings.Join(s, ", "))
+}
+
+// GetObservedCompositeResourceInto loads the observed composite resource from
+// the supplied request into the supplied object, which is typically the
+// Function's own Go type for the composite resource. It returns the observed
+// composite resource's connection details.
+func GetObservedCompositeResourceInto(req *v1beta1.RunFunctionRequest, into runtime.Object) (resource.ConnectionDetails, error) {
+	cd := req.GetObserved().GetComposite().GetConnectionDetails()
+	if cd == nil {
+		cd = make(resource.ConnectionDetails)
+	}
+	err := resource.AsObject(req.GetObserved().GetComposite().GetResource(), into)
+	return cd, errors.Wrapf(err, "cannot get observed composite resource into %T", into)
+}
+
 // GetObservedComposedResources from the supplied request.
 func GetObservedComposedResources(req *v1beta1.RunFunctionRequest) (map[resource.Name]resource.ObservedComposed, error) {
 	ocds := map[resource.Name]resource.ObservedComposed{}
 	for name, r := range req.GetObserved().GetResources() {
-		ocd := resource.ObservedComposed{Resource: composed.New(), ConnectionDetails: r.GetConnectionDetails()}
-
-		if ocd.ConnectionDetails == nil {
-			ocd.ConnectionDetails = make(resource.ConnectionDetails)
-		}
-
-		if err := resource.AsObject(r.GetResource(), ocd.Resource); err != nil {
+		ocd, err := asObservedComposed(r)
+		if err != nil {
 			return nil, err
 		}
 		ocds[resource.Name(name)] = ocd
@@ -77,6 +356,17 @@ func GetObservedComposedResources(req *v1beta1.RunFunctionRequest) (map[resource
 	return ocds, nil
 }
 
+func asObservedComposed(r *v1beta1.Resource) (resource.ObservedComposed, error) {
+	ocd := resource.ObservedComposed{Resource: composed.New(), ConnectionDetails: r.GetConnectionDetails()}
+
+	if ocd.ConnectionDetails == nil {
+		ocd.ConnectionDetails = make(resource.ConnectionDetails)
+	}
+
+	err := resource.AsObject(r.GetResource(), ocd.Resource)
+	return ocd, err
+}
+
 // GetDesiredCompositeResource from the supplied request.
 func GetDesiredCompositeResource(req *v1beta1.RunFunctionRequest) (*resource.Composite, error) {
 	xr := &resource.Composite{
@@ -96,23 +386,81 @@ func GetDesiredCompositeResource(req *v1beta1.RunFunctionRequest) (*resource.Com
 func GetDesiredComposedResources(req *v1beta1.RunFunctionRequest) (map[resource.Name]*resource.DesiredComposed, error) {
 	dcds := map[resource.Name]*resource.DesiredComposed{}
 	for name, r := range req.GetDesired().GetResources() {
-		dcd := &resource.DesiredComposed{Resource: composed.New()}
-		if err := resource.AsObject(r.GetResource(), dcd.Resource); err != nil {
+		dcd, err := asDesiredComposed(r)
+		if err != nil {
 			return nil, err
 		}
-		switch r.GetReady() {
-		case v1beta1.Ready_READY_UNSPECIFIED:
-			dcd.Ready = resource.ReadyUnspecified
-		case v1beta1.Ready_READY_TRUE:
-			dcd.Ready = resource.ReadyTrue
-		case v1beta1.Ready_READY_FALSE:
-			dcd.Ready = resource.ReadyFalse
-		}
 		dcds[resource.Name(name)] = dcd
 	}
 	return dcds, nil
 }
 
+func asDesiredComposed(r *v1beta1.Resource) (*resource.DesiredComposed, error) {
+	dcd := &resource.DesiredComposed{Resource: composed.New()}
+	if err := resource.AsObject(r.GetResource(), dcd.Resource); err != nil {
+		return nil, err
+	}
+	switch r.GetReady() {
+	case v1beta1.Ready_READY_UNSPECIFIED:
+		dcd.Ready = resource.ReadyUnspecified
+	case v1beta1.Ready_READY_TRUE:
+		dcd.Ready = resource.ReadyTrue
+	case v1beta1.Ready_READY_FALSE:
+		dcd.Ready = resource.ReadyFalse
+	}
+	return dcd, nil
+}
+
+// GetComposedResource returns the observed and desired state of the supplied
+// composed resource from the supplied request. Either is nil if the request
+// doesn't contain it.
+func GetComposedResource(req *v1beta1.RunFunctionRequest, name resource.Name) (*resource.ObservedComposed, *resource.DesiredComposed, error) {
+	var ocd *resource.ObservedComposed
+	if r, ok := req.GetObserved().GetResources()[string(name)]; ok {
+		o, err := asObservedComposed(r)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "cannot get observed composed resource %q", name)
+		}
+		ocd = &o
+	}
+
+	var dcd *resource.DesiredComposed
+	if r, ok := req.GetDesired().GetResources()[string(name)]; ok {
+		d, err := asDesiredComposed(r)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "cannot get desired composed resource %q", name)
+		}
+		dcd = d
+	}
+
+	return ocd, dcd, nil
+}
+
+// DetectKindDrift returns the sorted names of composed resources in the
+// supplied request whose observed kind differs from their desired kind. A
+// composed resource's kind can't be changed in place, so Crossplane will delete
+// and recreate these resources. A change of API version alone isn't considered
+// drift. Composed resources that aren't both observed and desired are ignored.
+func DetectKindDrift(req *v1beta1.RunFunctionRequest) []resource.Name {
+	names := make([]resource.Name, 0)
+	for name, d := range req.GetDesired().GetResources() {
+		o, ok := req.GetObserved().GetResources()[name]
+		if !ok {
+			continue
+		}
+		if groupKind(o.GetResource()) != groupKind(d.GetResource()) {
+			names = append(names, resource.Name(name))
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+func groupKind(s *structpb.Struct) schema.GroupKind {
+	gv, _ := schema.ParseGroupVersion(s.GetFields()["apiVersion"].GetStringValue())
+	return schema.GroupKind{Group: gv.Group, Kind: s.GetFields()["kind"].GetStringValue()}
+}
+
 // GetExtraResources from the supplied request.
 func GetExtraResources(req *v1beta1.RunFunctionRequest) (map[string][]resource.Extra, error) {
 	out := make(map[string][]resource.Extra, len(req.GetExtraResources()))
@@ -128,3 +476,129 @@ func GetExtraResources(req *v1beta1.RunFunctionRequest) (map[string][]resource.E
 	}
 	return out, nil
 }
+
+// GetExtraResourcesAs returns the extra resources with the supplied ID from the
+// supplied request, loaded into the supplied Go type. For example:
+//
+//	subnets, err := GetExtraResourcesAs[ec2v1beta1.Subnet](req, "subnets")
+//
+// If the type is registered with composed.Scheme it returns an error if an
+// extra resource isn't of that type. It returns an empty slice if the request
+// contains no extra resources with the supplied ID.
+func GetExtraResourcesAs[T any, P interface {
+	*T
+	runtime.Object
+}](req *v1beta1.RunFunctionRequest, id string) ([]P, error) {
+	var want schema.GroupVersionKind
+	if gvks, _, err := composed.Scheme.ObjectKinds(P(new(T))); err == nil && len(gvks) > 0 {
+		want = gvks[0]
+	}
+	items := req.GetExtraResources()[id].GetItems()
+	out := make([]P, 0, len(items))
+	for i, item := range items {
+		o := P(new(T))
+		if err := resource.AsObject(item.GetResource(), o); err != nil {
+			return nil, errors.Wrapf(err, "cannot get extra resource %d with ID %q into %T", i, id, o)
+		}
+		if got := o.GetObjectKind().GroupVersionKind(); !want.Empty() && got != want {
+			return nil, errors.Errorf("extra resource %d with ID %q is a %s, not a %s", i, id, got, want)
+		}
+		out = append(out, o)
+	}
+	return out, nil
+}
+
+// ExpectExtraResources returns the extra resources with the supplied ID from
+// the supplied request. It returns an error if there are fewer than minimum or
+// more than maximum extra resources. A negative maximum means there is no
+// maximum. For example use a minimum and maximum of one to get a singleton.
+func ExpectExtraResources(req *v1beta1.RunFunctionRequest, id string, minimum, maximum int) ([]resource.Extra, error) {
+	items := req.GetExtraResources()[id].GetItems()
+	switch {
+	case len(items) < minimum:
+		return nil, errors.Errorf("found %d extra resources with ID %q, expected at least %d", len(items), id, minimum)
+	case maximum >= 0 && len(items) > maximum:
+		return nil, errors.Errorf("found %d extra resources with ID %q, expected at most %d", len(items), id, maximum)
+	}
+	out := make([]resource.Extra, 0, len(items))
+	for _, i := range items {
+		r := resource.Extra{Resource: &unstructured.Unstructured{}}
+		if err := resource.AsObject(i.GetResource(), r.Resource); err != nil {
+			return nil, errors.Wrapf(err, "cannot get extra resource with ID %q", id)
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// RequireExtraResources returns true if Crossplane has fetched the extra
+// resources for each of the supplied IDs. If it hasn't, it adds a normal result
+// to the supplied response explaining which extra resources the Function is
+// waiting for, and returns false. It doesn't modify the response's desired
+// state, so a Function that returns while waiting won't cause any desired
+// resources to be deleted.
+//
+// Crossplane includes an ID in the request's extra resources once it has
+// fetched them, even if no resources matched. Waiting won't change that, so
+// RequireExtraResources returns true for IDs that were fetched but matched no
+// resources, and adds a normal result explaining which IDs are empty.
+func RequireExtraResources(req *v1beta1.RunFunctionRequest, rsp *v1beta1.RunFunctionResponse, ids ...string) bool {
+	missing, empty := missingExtraResources(req, ids...)
+	if len(missing) > 0 {
+		response.Normalf(rsp, "waiting for extra resources: %s", strings.Join(missing, ", "))
+		return false
+	}
+	if len(empty) > 0 {
+		response.Normalf(rsp, "no extra resources matched: %s", strings.Join(empty, ", "))
+	}
+	return true
+}
+
+// ExtraResourcesDeadlineMargin is how close to its deadline
+// ExtraResourcesOrWait considers a Function to be.
+const ExtraResourcesDeadlineMargin = 5 * time.Second
+
+// ExtraResourcesOrWait is like RequireExtraResources, except that it returns
+// true if the supplied deadline is less than ExtraResourcesDeadlineMargin away,
+// even if some extra resources are missing. When it does so it adds a warning
+// result to the supplied response explaining which extra resources are
+// missing. A zero deadline means there is no deadline - see GetDeadline. Like
+// RequireExtraResources, it treats extra resources that were fetched but
+// matched nothing as present, and adds a normal result explaining which IDs
+// are empty.
+//
+// Use it when producing desired state from partial data is better than
+// producing none at all. The tradeoff is that the Function must handle missing
+// extra resources when it proceeds, and that it may produce different desired
+// state once they arrive.
+func ExtraResourcesOrWait(req *v1beta1.RunFunctionRequest, rsp *v1beta1.RunFunctionResponse, deadline time.Time, ids ...string) bool {
+	missing, empty := missingExtraResources(req, ids...)
+	if len(empty) > 0 {
+		response.Normalf(rsp, "no extra resources matched: %s", strings.Join(empty, ", "))
+	}
+	if len(missing) == 0 {
+		return true
+	}
+	if !deadline.IsZero() && time.Until(deadline) < ExtraResourcesDeadlineMargin {
+		response.Warning(rsp, errors.Errorf("proceeding without extra resources because the deadline is near: %s", strings.Join(missing, ", ")))
+		return true
+	}
+	response.Normalf(rsp, "waiting for extra resources: %s", strings.Join(missing, ", "))
+	return false
+}
+
+// missingExtraResources returns the supplied IDs for which Crossplane hasn't
+// yet fetched extra resources, and the supplied IDs for which it fetched extra
+// resources but none matched.
+func missingExtraResources(req *v1beta1.RunFunctionRequest, ids ...string) (missing, empty []string) {
+	for _, id := range ids {
+		r, ok := req.GetExtraResources()[id]
+		switch {
+		case !ok:
+			missing = append(missing, id)
+		case len(r.GetItems()) == 0:
+			empty = append(empty, id)
+		}
+	}
+	return missing, empty
+}
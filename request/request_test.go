@@ -18,11 +18,26 @@ limitations under the License.
 package request
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/structpb"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	fncontext "github.com/crossplane/function-sdk-go/context"
+	"github.com/crossplane/function-sdk-go/errors"
 	"github.com/crossplane/function-sdk-go/proto/v1beta1"
 	"github.com/crossplane/function-sdk-go/resource"
 	"github.com/crossplane/function-sdk-go/resource/composed"
@@ -290,3 +305,1133 @@ func TestGetDesiredComposedResources(t *testing.T) {
 		})
 	}
 }
+
+func TestRequireExtraResources(t *testing.T) {
+	type args struct {
+		req *v1beta1.RunFunctionRequest
+		ids []string
+	}
+	type want struct {
+		ok  bool
+		rsp *v1beta1.RunFunctionResponse
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"AllPresent": {
+			reason: "If all required extra resources are present we should return true and not add a result.",
+			args: args{
+				req: &v1beta1.RunFunctionRequest{
+					ExtraResources: map[string]*v1beta1.Resources{
+						"a": {Items: []*v1beta1.Resource{{}}},
+					},
+				},
+				ids: []string{"a"},
+			},
+			want: want{
+				ok:  true,
+				rsp: &v1beta1.RunFunctionResponse{},
+			},
+		},
+		"SomeMissing": {
+			reason: "If any required extra resources haven't been fetched we should return false and add a normal result.",
+			args: args{
+				req: &v1beta1.RunFunctionRequest{
+					ExtraResources: map[string]*v1beta1.Resources{
+						"a": {Items: []*v1beta1.Resource{{}}},
+						"b": {},
+					},
+				},
+				ids: []string{"a", "b", "c"},
+			},
+			want: want{
+				ok: false,
+				rsp: &v1beta1.RunFunctionResponse{
+					Results: []*v1beta1.Result{{
+						Severity: v1beta1.Severity_SEVERITY_NORMAL,
+						Message:  "waiting for extra resources: c",
+					}},
+				},
+			},
+		},
+		"FetchedButEmpty": {
+			reason: "If required extra resources were fetched but matched nothing we should return true and add a normal result.",
+			args: args{
+				req: &v1beta1.RunFunctionRequest{
+					ExtraResources: map[string]*v1beta1.Resources{
+						"a": {Items: []*v1beta1.Resource{{}}},
+						"b": {},
+					},
+				},
+				ids: []string{"a", "b"},
+			},
+			want: want{
+				ok: true,
+				rsp: &v1beta1.RunFunctionResponse{
+					Results: []*v1beta1.Result{{
+						Severity: v1beta1.Severity_SEVERITY_NORMAL,
+						Message:  "no extra resources matched: b",
+					}},
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := &v1beta1.RunFunctionResponse{}
+			ok := RequireExtraResources(tc.args.req, rsp, tc.args.ids...)
+
+			if diff := cmp.Diff(tc.want.ok, ok); diff != "" {
+				t.Errorf("\n%s\nRequireExtraResources(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.rsp, rsp, protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\nRequireExtraResources(...): -want rsp, +got rsp:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestGetComposedResource(t *testing.T) {
+	type want struct {
+		ocd *resource.ObservedComposed
+		dcd *resource.DesiredComposed
+		err error
+	}
+
+	cases := map[string]struct {
+		reason string
+		req    *v1beta1.RunFunctionRequest
+		want   want
+	}{
+		"Absent": {
+			reason: "If the request doesn't contain the composed resource we should return nils.",
+			req:    &v1beta1.RunFunctionRequest{},
+			want:   want{},
+		},
+		"ObservedAndDesired": {
+			reason: "If the request contains observed and desired state for the composed resource we should return both.",
+			req: &v1beta1.RunFunctionRequest{
+				Observed: &v1beta1.State{
+					Resources: map[string]*v1beta1.Resource{
+						"cool-resource": {
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "test.crossplane.io/v1",
+								"kind": "Composed",
+								"status": {"ready": true}
+							}`),
+						},
+					},
+				},
+				Desired: &v1beta1.State{
+					Resources: map[string]*v1beta1.Resource{
+						"cool-resource": {
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "test.crossplane.io/v1",
+								"kind": "Composed"
+							}`),
+							Ready: v1beta1.Ready_READY_TRUE,
+						},
+					},
+				},
+			},
+			want: want{
+				ocd: &resource.ObservedComposed{
+					Resource: &composed.Unstructured{Unstructured: unstructured.Unstructured{
+						Object: map[string]any{
+							"apiVersion": "test.crossplane.io/v1",
+							"kind":       "Composed",
+							"status":     map[string]any{"ready": true},
+						},
+					}},
+					ConnectionDetails: resource.ConnectionDetails{},
+				},
+				dcd: &resource.DesiredComposed{
+					Resource: &composed.Unstructured{Unstructured: unstructured.Unstructured{
+						Object: map[string]any{
+							"apiVersion": "test.crossplane.io/v1",
+							"kind":       "Composed",
+						},
+					}},
+					Ready: resource.ReadyTrue,
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ocd, dcd, err := GetComposedResource(tc.req, "cool-resource")
+
+			if diff := cmp.Diff(tc.want.ocd, ocd); diff != "" {
+				t.Errorf("\n%s\nGetComposedResource(...): -want observed, +got observed:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.dcd, dcd); diff != "" {
+				t.Errorf("\n%s\nGetComposedResource(...): -want desired, +got desired:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, err); diff != "" {
+				t.Errorf("\n%s\nGetComposedResource(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestGetContextBytes(t *testing.T) {
+	type want struct {
+		b   []byte
+		ok  bool
+		err error
+	}
+
+	cases := map[string]struct {
+		reason string
+		req    *v1beta1.RunFunctionRequest
+		want   want
+	}{
+		"NotSet": {
+			reason: "We should return false if the key isn't set.",
+			req:    &v1beta1.RunFunctionRequest{},
+			want:   want{},
+		},
+		"NotAString": {
+			reason: "We should return an error if the key isn't a string.",
+			req: &v1beta1.RunFunctionRequest{
+				Context: &structpb.Struct{Fields: map[string]*structpb.Value{
+					"key": structpb.NewBoolValue(true),
+				}},
+			},
+			want: want{
+				ok:  true,
+				err: errors.Errorf("context key %q is not a string", "key"),
+			},
+		},
+		"Bytes": {
+			reason: "We should decode base64 encoded bytes.",
+			req: &v1beta1.RunFunctionRequest{
+				Context: &structpb.Struct{Fields: map[string]*structpb.Value{
+					"key": structpb.NewStringValue("c2VjcmV0"),
+				}},
+			},
+			want: want{
+				b:  []byte("secret"),
+				ok: true,
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			b, ok, err := GetContextBytes(tc.req, "key")
+
+			if diff := cmp.Diff(tc.want.b, b); diff != "" {
+				t.Errorf("\n%s\nGetContextBytes(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.ok, ok); diff != "" {
+				t.Errorf("\n%s\nGetContextBytes(...): -want ok, +got ok:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nGetContextBytes(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRequireCompositeKind(t *testing.T) {
+	allowed := []schema.GroupVersionKind{
+		{Group: "example.org", Version: "v1", Kind: "XCool"},
+		{Group: "example.org", Version: "v1", Kind: "XNeat"},
+	}
+
+	cases := map[string]struct {
+		reason string
+		req    *v1beta1.RunFunctionRequest
+		want   error
+	}{
+		"NoObservedXR": {
+			reason: "We should return an error if there is no observed XR.",
+			req:    &v1beta1.RunFunctionRequest{},
+			want:   errors.New("request has no observed composite resource"),
+		},
+		"Allowed": {
+			reason: "We should not return an error if the observed XR is an allowed kind.",
+			req: &v1beta1.RunFunctionRequest{
+				Observed: &v1beta1.State{
+					Composite: &v1beta1.Resource{
+						Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"XNeat"}`),
+					},
+				},
+			},
+		},
+		"NotAllowed": {
+			reason: "We should return an error if the observed XR isn't an allowed kind.",
+			req: &v1beta1.RunFunctionRequest{
+				Observed: &v1beta1.State{
+					Composite: &v1beta1.Resource{
+						Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"XLame"}`),
+					},
+				},
+			},
+			want: errors.New(`unsupported composite resource kind "example.org/v1, Kind=XLame" - must be one of [example.org/v1, Kind=XCool, example.org/v1, Kind=XNeat]`),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := RequireCompositeKind(tc.req, allowed...)
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nRequireCompositeKind(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestGetObservedCompositeResourceInto(t *testing.T) {
+	req := &v1beta1.RunFunctionRequest{
+		Observed: &v1beta1.State{
+			Composite: &v1beta1.Resource{
+				Resource: resource.MustStructJSON(`{
+					"apiVersion": "v1",
+					"kind": "ConfigMap",
+					"metadata": {"name": "cool"},
+					"data": {"widgets": "9001"}
+				}`),
+				ConnectionDetails: map[string][]byte{
+					"super": []byte("secret"),
+				},
+			},
+		},
+	}
+
+	cm := &corev1.ConfigMap{}
+	cd, err := GetObservedCompositeResourceInto(req, cm)
+	if err != nil {
+		t.Fatalf("GetObservedCompositeResourceInto(...): unexpected error: %v", err)
+	}
+
+	want := &corev1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{Name: "cool"},
+		Data:       map[string]string{"widgets": "9001"},
+	}
+	if diff := cmp.Diff(want, cm); diff != "" {
+		t.Errorf("GetObservedCompositeResourceInto(...): -want, +got:\n%s", diff)
+	}
+	if diff := cmp.Diff(resource.ConnectionDetails{"super": []byte("secret")}, cd); diff != "" {
+		t.Errorf("GetObservedCompositeResourceInto(...): -want connection details, +got connection details:\n%s", diff)
+	}
+}
+
+func TestValidateInput(t *testing.T) {
+	s := &apiextensions.JSONSchemaProps{
+		Type:     "object",
+		Required: []string{"count"},
+		Properties: map[string]apiextensions.JSONSchemaProps{
+			"count": {Type: "integer"},
+		},
+	}
+
+	type want struct {
+		types  []field.ErrorType
+		fields []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		req    *v1beta1.RunFunctionRequest
+		want   want
+	}{
+		"Valid": {
+			reason: "We should return no errors if the input is valid.",
+			req:    &v1beta1.RunFunctionRequest{Input: resource.MustStructJSON(`{"count":3}`)},
+		},
+		"Missing": {
+			reason: "We should return an error for a missing required field.",
+			req:    &v1beta1.RunFunctionRequest{Input: resource.MustStructJSON(`{}`)},
+			want: want{
+				types:  []field.ErrorType{field.ErrorTypeRequired},
+				fields: []string{"count"},
+			},
+		},
+		"WrongType": {
+			reason: "We should return an error for a field of the wrong type.",
+			req:    &v1beta1.RunFunctionRequest{Input: resource.MustStructJSON(`{"count":"three"}`)},
+			want: want{
+				types:  []field.ErrorType{field.ErrorTypeTypeInvalid},
+				fields: []string{"count"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			errs := ValidateInput(tc.req, s)
+			var got want
+			for _, err := range errs {
+				got.types = append(got.types, err.Type)
+				got.fields = append(got.fields, err.Field)
+			}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("\n%s\nValidateInput(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestGetContextObjectOrDefault(t *testing.T) {
+	def := &unstructured.Unstructured{Object: map[string]any{"replicas": float64(1)}}
+
+	type want struct {
+		into *unstructured.Unstructured
+		err  error
+	}
+
+	cases := map[string]struct {
+		reason string
+		req    *v1beta1.RunFunctionRequest
+		want   want
+	}{
+		"NotSet": {
+			reason: "We should load the default if the context key isn't set.",
+			req:    &v1beta1.RunFunctionRequest{},
+			want: want{
+				into: &unstructured.Unstructured{Object: map[string]any{"replicas": float64(1)}},
+			},
+		},
+		"NotAnObject": {
+			reason: "We should return an error if the context key isn't an object.",
+			req: &v1beta1.RunFunctionRequest{
+				Context: &structpb.Struct{Fields: map[string]*structpb.Value{
+					"key": structpb.NewStringValue("nope"),
+				}},
+			},
+			want: want{
+				into: &unstructured.Unstructured{},
+				err:  errors.New(`context key "key" is not an object`),
+			},
+		},
+		"Set": {
+			reason: "We should load the context key if it's set.",
+			req: &v1beta1.RunFunctionRequest{
+				Context: &structpb.Struct{Fields: map[string]*structpb.Value{
+					"key": structpb.NewStructValue(resource.MustStructJSON(`{"replicas":3}`)),
+				}},
+			},
+			want: want{
+				into: &unstructured.Unstructured{Object: map[string]any{"replicas": float64(3)}},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			into := &unstructured.Unstructured{}
+			err := GetContextObjectOrDefault(tc.req, "key", into, def)
+
+			if diff := cmp.Diff(tc.want.into, into); diff != "" {
+				t.Errorf("\n%s\nGetContextObjectOrDefault(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nGetContextObjectOrDefault(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestGetInputField(t *testing.T) {
+	req := &v1beta1.RunFunctionRequest{
+		Input: resource.MustStructJSON(`{"spec":{"replicas":3,"region":"us-east-1"}}`),
+	}
+
+	type want struct {
+		into int
+		ok   bool
+		err  bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		path   string
+		want   want
+	}{
+		"NotFound": {
+			reason: "We should return false if the field path doesn't exist.",
+			path:   "spec.zone",
+		},
+		"WrongType": {
+			reason: "We should return an error if the field can't be loaded into the supplied value.",
+			path:   "spec.region",
+			want:   want{err: true},
+		},
+		"InvalidPath": {
+			reason: "We should return an error if the field path is invalid.",
+			path:   "a[",
+			want:   want{err: true},
+		},
+		"Found": {
+			reason: "We should load the field into the supplied value.",
+			path:   "spec.replicas",
+			want:   want{into: 3, ok: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var into int
+			ok, err := GetInputField(req, tc.path, &into)
+
+			if diff := cmp.Diff(tc.want.into, into); diff != "" {
+				t.Errorf("\n%s\nGetInputField(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.ok, ok); diff != "" {
+				t.Errorf("\n%s\nGetInputField(...): -want ok, +got ok:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, err != nil); diff != "" {
+				t.Errorf("\n%s\nGetInputField(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestGetInputRaw(t *testing.T) {
+	type want struct {
+		j   string
+		err error
+	}
+
+	cases := map[string]struct {
+		reason string
+		req    *v1beta1.RunFunctionRequest
+		want   want
+	}{
+		"NoInput": {
+			reason: "We should return an error if the request has no input.",
+			req:    &v1beta1.RunFunctionRequest{},
+			want:   want{err: errors.New("request has no input")},
+		},
+		"Input": {
+			reason: "We should return the input encoded as JSON.",
+			req:    &v1beta1.RunFunctionRequest{Input: resource.MustStructJSON(`{"format":"toml","data":"a = 1"}`)},
+			want:   want{j: `{"data":"a = 1","format":"toml"}`},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			b, err := GetInputRaw(tc.req)
+
+			// protojson doesn't guarantee stable output, so compare the
+			// decoded JSON rather than the raw bytes.
+			var got, want any
+			if len(b) > 0 {
+				_ = json.Unmarshal(b, &got)
+			}
+			if tc.want.j != "" {
+				_ = json.Unmarshal([]byte(tc.want.j), &want)
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("\n%s\nGetInputRaw(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nGetInputRaw(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestExtraResourcesOrWait(t *testing.T) {
+	req := &v1beta1.RunFunctionRequest{
+		ExtraResources: map[string]*v1beta1.Resources{
+			"a": {Items: []*v1beta1.Resource{{}}},
+			"e": {},
+		},
+	}
+
+	type args struct {
+		deadline time.Time
+		ids      []string
+	}
+	type want struct {
+		ok  bool
+		rsp *v1beta1.RunFunctionResponse
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"AllPresent": {
+			reason: "If all required extra resources are present we should return true and not add a result.",
+			args:   args{deadline: time.Now(), ids: []string{"a"}},
+			want:   want{ok: true, rsp: &v1beta1.RunFunctionResponse{}},
+		},
+		"FetchedButEmpty": {
+			reason: "If required extra resources were fetched but matched nothing we should return true and add a normal result.",
+			args:   args{ids: []string{"a", "e"}},
+			want: want{
+				ok: true,
+				rsp: &v1beta1.RunFunctionResponse{
+					Results: []*v1beta1.Result{{
+						Severity: v1beta1.Severity_SEVERITY_NORMAL,
+						Message:  "no extra resources matched: e",
+					}},
+				},
+			},
+		},
+		"NoDeadline": {
+			reason: "If there is no deadline we should wait for missing extra resources.",
+			args:   args{ids: []string{"a", "b"}},
+			want: want{
+				ok: false,
+				rsp: &v1beta1.RunFunctionResponse{
+					Results: []*v1beta1.Result{{
+						Severity: v1beta1.Severity_SEVERITY_NORMAL,
+						Message:  "waiting for extra resources: b",
+					}},
+				},
+			},
+		},
+		"DeadlineFar": {
+			reason: "If the deadline is far away we should wait for missing extra resources.",
+			args:   args{deadline: time.Now().Add(time.Hour), ids: []string{"a", "b"}},
+			want: want{
+				ok: false,
+				rsp: &v1beta1.RunFunctionResponse{
+					Results: []*v1beta1.Result{{
+						Severity: v1beta1.Severity_SEVERITY_NORMAL,
+						Message:  "waiting for extra resources: b",
+					}},
+				},
+			},
+		},
+		"DeadlineNear": {
+			reason: "If the deadline is near we should proceed without missing extra resources, and add a warning result.",
+			args:   args{deadline: time.Now().Add(time.Second), ids: []string{"a", "b"}},
+			want: want{
+				ok: true,
+				rsp: &v1beta1.RunFunctionResponse{
+					Results: []*v1beta1.Result{{
+						Severity: v1beta1.Severity_SEVERITY_WARNING,
+						Message:  "proceeding without extra resources because the deadline is near: b",
+					}},
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := &v1beta1.RunFunctionResponse{}
+			ok := ExtraResourcesOrWait(req, rsp, tc.args.deadline, tc.args.ids...)
+
+			if diff := cmp.Diff(tc.want.ok, ok); diff != "" {
+				t.Errorf("\n%s\nExtraResourcesOrWait(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.rsp, rsp, protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\nExtraResourcesOrWait(...): -want rsp, +got rsp:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestGetEnvironment(t *testing.T) {
+	type want struct {
+		env *unstructured.Unstructured
+		err error
+	}
+
+	cases := map[string]struct {
+		reason string
+		req    *v1beta1.RunFunctionRequest
+		want   want
+	}{
+		"NoEnvironment": {
+			reason: "We should return an empty environment if the context doesn't contain one.",
+			req:    &v1beta1.RunFunctionRequest{},
+			want:   want{env: &unstructured.Unstructured{Object: map[string]any{}}},
+		},
+		"NotAnObject": {
+			reason: "We should return an error if the environment isn't an object.",
+			req: &v1beta1.RunFunctionRequest{
+				Context: &structpb.Struct{Fields: map[string]*structpb.Value{
+					fncontext.KeyEnvironment: structpb.NewStringValue("nope"),
+				}},
+			},
+			want: want{err: errors.Errorf("context key %q is not an object", fncontext.KeyEnvironment)},
+		},
+		"Environment": {
+			reason: "We should return the environment from the context.",
+			req: &v1beta1.RunFunctionRequest{
+				Context: &structpb.Struct{Fields: map[string]*structpb.Value{
+					fncontext.KeyEnvironment: structpb.NewStructValue(resource.MustStructJSON(`{"region":"us-east-1"}`)),
+				}},
+			},
+			want: want{env: &unstructured.Unstructured{Object: map[string]any{"region": "us-east-1"}}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			env, err := GetEnvironment(tc.req)
+
+			if diff := cmp.Diff(tc.want.env, env); diff != "" {
+				t.Errorf("\n%s\nGetEnvironment(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nGetEnvironment(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestExpectExtraResources(t *testing.T) {
+	req := &v1beta1.RunFunctionRequest{
+		ExtraResources: map[string]*v1beta1.Resources{
+			"one": {Items: []*v1beta1.Resource{
+				{Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"Config","metadata":{"name":"a"}}`)},
+			}},
+			"two": {Items: []*v1beta1.Resource{{}, {}}},
+		},
+	}
+
+	type args struct {
+		id      string
+		minimum int
+		maximum int
+	}
+	type want struct {
+		extras []resource.Extra
+		err    error
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"TooFew": {
+			reason: "We should return an error if there are fewer extra resources than the minimum.",
+			args:   args{id: "none", minimum: 1, maximum: 1},
+			want:   want{err: errors.New(`found 0 extra resources with ID "none", expected at least 1`)},
+		},
+		"TooMany": {
+			reason: "We should return an error if there are more extra resources than the maximum.",
+			args:   args{id: "two", minimum: 1, maximum: 1},
+			want:   want{err: errors.New(`found 2 extra resources with ID "two", expected at most 1`)},
+		},
+		"NoMaximum": {
+			reason: "We should return the extra resources if there is no maximum.",
+			args:   args{id: "two", minimum: 1, maximum: -1},
+			want: want{extras: []resource.Extra{
+				{Resource: &unstructured.Unstructured{Object: map[string]any{}}},
+				{Resource: &unstructured.Unstructured{Object: map[string]any{}}},
+			}},
+		},
+		"Singleton": {
+			reason: "We should return the extra resource if there is exactly one.",
+			args:   args{id: "one", minimum: 1, maximum: 1},
+			want: want{extras: []resource.Extra{
+				{Resource: &unstructured.Unstructured{Object: map[string]any{
+					"apiVersion": "example.org/v1",
+					"kind":       "Config",
+					"metadata":   map[string]any{"name": "a"},
+				}}},
+			}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			extras, err := ExpectExtraResources(req, tc.args.id, tc.args.minimum, tc.args.maximum)
+
+			if diff := cmp.Diff(tc.want.extras, extras); diff != "" {
+				t.Errorf("\n%s\nExpectExtraResources(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nExpectExtraResources(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestGetInputWith(t *testing.T) {
+	type input struct {
+		Replicas int `json:"replicas"`
+	}
+
+	// A codec that reads replicas from a string field, e.g. "3".
+	custom := InputCodecFn(func(in *structpb.Struct, into any) error {
+		i, ok := into.(*input)
+		if !ok {
+			return errors.Errorf("cannot decode into %T", into)
+		}
+		_, err := fmt.Sscanf(in.GetFields()["data"].GetStringValue(), "%d", &i.Replicas)
+		return err
+	})
+
+	type args struct {
+		req   *v1beta1.RunFunctionRequest
+		codec InputCodec
+	}
+	type want struct {
+		into input
+		err  error
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"JSON": {
+			reason: "The JSON codec should decode input into any Go value.",
+			args: args{
+				req:   &v1beta1.RunFunctionRequest{Input: resource.MustStructJSON(`{"replicas":3}`)},
+				codec: JSONInputCodec,
+			},
+			want: want{into: input{Replicas: 3}},
+		},
+		"Custom": {
+			reason: "We should decode input using the supplied codec.",
+			args: args{
+				req:   &v1beta1.RunFunctionRequest{Input: resource.MustStructJSON(`{"data":"5"}`)},
+				codec: custom,
+			},
+			want: want{into: input{Replicas: 5}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := input{}
+			err := GetInputWith(tc.args.req, tc.args.codec, &got)
+
+			if diff := cmp.Diff(tc.want.into, got); diff != "" {
+				t.Errorf("\n%s\nGetInputWith(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nGetInputWith(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestGetInputMerged(t *testing.T) {
+	defaults := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "example.org/v1",
+		"kind":       "Input",
+		"spec": map[string]any{
+			"replicas": float64(1),
+			"enabled":  true,
+			"network":  map[string]any{"zone": "a", "cidr": "10.0.0.0/8"},
+		},
+	}}
+
+	cases := map[string]struct {
+		reason string
+		req    *v1beta1.RunFunctionRequest
+		want   *unstructured.Unstructured
+	}{
+		"NoInput": {
+			reason: "We should load the defaults if there is no input.",
+			req:    &v1beta1.RunFunctionRequest{},
+			want:   defaults.DeepCopy(),
+		},
+		"Overrides": {
+			reason: "We should deep merge the input over the defaults, with explicit zero values winning.",
+			req: &v1beta1.RunFunctionRequest{
+				Input: resource.MustStructJSON(`{"spec":{"enabled":false,"network":{"zone":"b"}}}`),
+			},
+			want: &unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": "example.org/v1",
+				"kind":       "Input",
+				"spec": map[string]any{
+					"replicas": float64(1),
+					"enabled":  false,
+					"network":  map[string]any{"zone": "b", "cidr": "10.0.0.0/8"},
+				},
+			}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := &unstructured.Unstructured{}
+			if err := GetInputMerged(tc.req, defaults, got); err != nil {
+				t.Fatalf("\n%s\nGetInputMerged(...): unexpected error: %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nGetInputMerged(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestGetInputTTL(t *testing.T) {
+	type want struct {
+		ttl time.Duration
+		err bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		input  string
+		want   want
+	}{
+		"Absent": {
+			reason: "We should return the default if the field path doesn't exist.",
+			input:  `{}`,
+			want:   want{ttl: time.Minute},
+		},
+		"NotAString": {
+			reason: "We should return an error if the field isn't a string.",
+			input:  `{"spec":{"ttl":30}}`,
+			want:   want{err: true},
+		},
+		"Invalid": {
+			reason: "We should return an error if the field isn't a valid duration.",
+			input:  `{"spec":{"ttl":"soon"}}`,
+			want:   want{err: true},
+		},
+		"Negative": {
+			reason: "We should return an error if the duration is negative.",
+			input:  `{"spec":{"ttl":"-30s"}}`,
+			want:   want{err: true},
+		},
+		"Valid": {
+			reason: "We should return the parsed duration.",
+			input:  `{"spec":{"ttl":"30s"}}`,
+			want:   want{ttl: 30 * time.Second},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			req := &v1beta1.RunFunctionRequest{Input: resource.MustStructJSON(tc.input)}
+			ttl, err := GetInputTTL(req, "spec.ttl", time.Minute)
+
+			if diff := cmp.Diff(tc.want.ttl, ttl); diff != "" {
+				t.Errorf("\n%s\nGetInputTTL(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, err != nil); diff != "" {
+				t.Errorf("\n%s\nGetInputTTL(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestDetectKindDrift(t *testing.T) {
+	req := &v1beta1.RunFunctionRequest{
+		Observed: &v1beta1.State{Resources: map[string]*v1beta1.Resource{
+			"same":    {Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"Bucket"}`)},
+			"version": {Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1beta1","kind":"Bucket"}`)},
+			"kind":    {Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"Bucket"}`)},
+			"group":   {Resource: resource.MustStructJSON(`{"apiVersion":"old.example.org/v1","kind":"Bucket"}`)},
+			"deleted": {Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"Bucket"}`)},
+		}},
+		Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{
+			"same":    {Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"Bucket"}`)},
+			"version": {Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"Bucket"}`)},
+			"kind":    {Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"Volume"}`)},
+			"group":   {Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"Bucket"}`)},
+			"new":     {Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"Volume"}`)},
+		}},
+	}
+
+	want := []resource.Name{"group", "kind"}
+	if diff := cmp.Diff(want, DetectKindDrift(req)); diff != "" {
+		t.Errorf("DetectKindDrift(...): -want, +got:\n%s", diff)
+	}
+}
+
+func TestWarnDeprecatedInput(t *testing.T) {
+	req := &v1beta1.RunFunctionRequest{
+		Input: resource.MustStructJSON(`{"spec":{"replicas":3,"region":"us-east-1"}}`),
+	}
+
+	type want struct {
+		rsp *v1beta1.RunFunctionResponse
+		err bool
+	}
+
+	cases := map[string]struct {
+		reason     string
+		deprecated map[string]string
+		want       want
+	}{
+		"NotSet": {
+			reason:     "We shouldn't warn about deprecated fields that aren't set.",
+			deprecated: map[string]string{"spec.zone": "use spec.region instead"},
+			want:       want{rsp: &v1beta1.RunFunctionResponse{}},
+		},
+		"Set": {
+			reason: "We should warn about each deprecated field that is set, in field path order.",
+			deprecated: map[string]string{
+				"spec.replicas": "use spec.count instead",
+				"spec.region":   "use spec.location instead",
+				"spec.zone":     "use spec.location instead",
+			},
+			want: want{rsp: &v1beta1.RunFunctionResponse{Results: []*v1beta1.Result{
+				{Severity: v1beta1.Severity_SEVERITY_WARNING, Message: `input field "spec.region" is deprecated: use spec.location instead`},
+				{Severity: v1beta1.Severity_SEVERITY_WARNING, Message: `input field "spec.replicas" is deprecated: use spec.count instead`},
+			}}},
+		},
+		"InvalidPath": {
+			reason:     "We should return an error if a field path is invalid.",
+			deprecated: map[string]string{"spec[": "oops"},
+			want:       want{rsp: &v1beta1.RunFunctionResponse{}, err: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := &v1beta1.RunFunctionResponse{}
+			err := WarnDeprecatedInput(req, rsp, tc.deprecated)
+			if diff := cmp.Diff(tc.want.rsp, rsp, protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\nWarnDeprecatedInput(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, err != nil); diff != "" {
+				t.Errorf("\n%s\nWarnDeprecatedInput(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestIsRenderMode(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		req    *v1beta1.RunFunctionRequest
+		want   bool
+	}{
+		"NotSet": {
+			reason: "We should return false if the render key isn't set.",
+			req:    &v1beta1.RunFunctionRequest{},
+			want:   false,
+		},
+		"NotBool": {
+			reason: "We should return false if the render key isn't a boolean.",
+			req: &v1beta1.RunFunctionRequest{Context: &structpb.Struct{Fields: map[string]*structpb.Value{
+				fncontext.KeyRender: structpb.NewStringValue("true"),
+			}}},
+			want: false,
+		},
+		"Set": {
+			reason: "We should return true if the render key is true.",
+			req: &v1beta1.RunFunctionRequest{Context: &structpb.Struct{Fields: map[string]*structpb.Value{
+				fncontext.KeyRender: structpb.NewBoolValue(true),
+			}}},
+			want: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := IsRenderMode(tc.req)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nIsRenderMode(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestGetExtraResourcesAs(t *testing.T) {
+	_ = corev1.AddToScheme(composed.Scheme)
+
+	req := &v1beta1.RunFunctionRequest{
+		ExtraResources: map[string]*v1beta1.Resources{
+			"configs": {Items: []*v1beta1.Resource{
+				{Resource: resource.MustStructJSON(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a"},"data":{"k":"v"}}`)},
+			}},
+			"mixed": {Items: []*v1beta1.Resource{
+				{Resource: resource.MustStructJSON(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a"}}`)},
+				{Resource: resource.MustStructJSON(`{"apiVersion":"v1","kind":"Secret","metadata":{"name":"b"}}`)},
+			}},
+		},
+	}
+
+	type want struct {
+		out []*corev1.ConfigMap
+		err bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		id     string
+		want   want
+	}{
+		"NotDelivered": {
+			reason: "We should return an empty slice if the request contains no extra resources with the ID.",
+			id:     "missing",
+			want:   want{out: []*corev1.ConfigMap{}},
+		},
+		"KindMismatch": {
+			reason: "We should return an error if an extra resource isn't of the requested type.",
+			id:     "mixed",
+			want:   want{err: true},
+		},
+		"Success": {
+			reason: "We should load extra resources into the requested type.",
+			id:     "configs",
+			want: want{out: []*corev1.ConfigMap{{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+				ObjectMeta: metav1.ObjectMeta{Name: "a"},
+				Data:       map[string]string{"k": "v"},
+			}}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			out, err := GetExtraResourcesAs[corev1.ConfigMap](req, tc.id)
+			if diff := cmp.Diff(tc.want.out, out); diff != "" {
+				t.Errorf("\n%s\nGetExtraResourcesAs(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, err != nil); diff != "" {
+				t.Errorf("\n%s\nGetExtraResourcesAs(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestGetDeadline(t *testing.T) {
+	deadline := time.Now().Add(time.Minute)
+	withDeadline, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	type want struct {
+		deadline time.Time
+		ok       bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		ctx    context.Context
+		want   want
+	}{
+		"NoDeadline": {
+			reason: "We should return false if the context has no deadline.",
+			ctx:    context.Background(),
+			want:   want{},
+		},
+		"Deadline": {
+			reason: "We should return the context's deadline.",
+			ctx:    withDeadline,
+			want:   want{deadline: deadline, ok: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, ok := GetDeadline(tc.ctx, &v1beta1.RunFunctionRequest{})
+			if diff := cmp.Diff(tc.want.deadline, got); diff != "" {
+				t.Errorf("\n%s\nGetDeadline(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.ok, ok); diff != "" {
+				t.Errorf("\n%s\nGetDeadline(...): -want ok, +got ok:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
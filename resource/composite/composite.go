@@ -21,6 +21,8 @@ limitations under the License.
 package composite
 
 import (
+	"fmt"
+
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -222,11 +224,48 @@ func (xr *Unstructured) GetCondition(ct xpv1.ConditionType) xpv1.Condition {
 
 // SetConditions of this composite resource.
 func (xr *Unstructured) SetConditions(conditions ...xpv1.Condition) {
+	xr.setConditions(nil, conditions...)
+}
+
+// SetConditionsWithObservedGeneration sets the supplied conditions of this
+// composite resource, recording that they reflect the supplied generation of
+// the composite resource.
+func (xr *Unstructured) SetConditionsWithObservedGeneration(generation int64, conditions ...xpv1.Condition) {
+	xr.setConditions(&generation, conditions...)
+}
+
+func (xr *Unstructured) setConditions(generation *int64, conditions ...xpv1.Condition) {
+	p := fieldpath.Pave(xr.Object)
+
+	// xpv1.Condition doesn't have an observedGeneration field, so we must
+	// record the existing ones before we overwrite the conditions.
+	generations := map[xpv1.ConditionType]any{}
+	existing := []map[string]any{}
+	_ = p.GetValueInto("status.conditions", &existing)
+	for _, c := range existing {
+		t, _ := c["type"].(string)
+		if g, ok := c["observedGeneration"]; ok {
+			generations[xpv1.ConditionType(t)] = g
+		}
+	}
+	for _, c := range conditions {
+		delete(generations, c.Type)
+		if generation != nil {
+			generations[c.Type] = *generation
+		}
+	}
+
 	conditioned := xpv1.ConditionedStatus{}
 	// The path is directly `status` because conditions are inline.
-	_ = fieldpath.Pave(xr.Object).GetValueInto("status", &conditioned)
+	_ = p.GetValueInto("status", &conditioned)
 	conditioned.SetConditions(conditions...)
-	_ = fieldpath.Pave(xr.Object).SetValue("status.conditions", conditioned.Conditions)
+	_ = p.SetValue("status.conditions", conditioned.Conditions)
+
+	for i, c := range conditioned.Conditions {
+		if g, ok := generations[c.Type]; ok {
+			_ = p.SetValue(fmt.Sprintf("status.conditions[%d].observedGeneration", i), g)
+		}
+	}
 }
 
 // GetConnectionDetailsLastPublishedTime of this composite resource.
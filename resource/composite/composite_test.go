@@ -23,6 +23,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"k8s.io/apimachinery/pkg/util/yaml"
 
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
 	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
 )
 
@@ -132,6 +133,45 @@ func TestGetInteger(t *testing.T) {
 
 }
 
+func TestSetConditionsWithObservedGeneration(t *testing.T) {
+	xr := New()
+
+	// Set a condition without an observed generation, then update another
+	// condition with one. The first condition should be unaffected.
+	xr.SetConditions(xpv1.ReconcileSuccess())
+	xr.SetConditionsWithObservedGeneration(2, xpv1.Creating())
+
+	var conditions []map[string]any
+	_ = fieldpath.Pave(xr.Object).GetValueInto("status.conditions", &conditions)
+
+	want := map[string]any{
+		"Synced": nil,
+		"Ready":  int64(2),
+	}
+	got := map[string]any{}
+	for _, c := range conditions {
+		t, _ := c["type"].(string)
+		got[t] = c["observedGeneration"]
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("SetConditionsWithObservedGeneration(...): -want observedGeneration, +got observedGeneration:\n%s", diff)
+	}
+
+	// Setting a condition without an observed generation should clear its
+	// previously recorded observed generation.
+	xr.SetConditions(xpv1.Available())
+	if diff := cmp.Diff(xpv1.Available(), xr.GetCondition(xpv1.TypeReady)); diff != "" {
+		t.Errorf("SetConditions(...): -want, +got:\n%s", diff)
+	}
+	conditions = nil
+	_ = fieldpath.Pave(xr.Object).GetValueInto("status.conditions", &conditions)
+	for _, c := range conditions {
+		if _, ok := c["observedGeneration"]; ok {
+			t.Errorf("SetConditions(...): condition %v unexpectedly has an observedGeneration", c["type"])
+		}
+	}
+}
+
 // EquateErrors returns true if the supplied errors are of the same type and
 // produce identical strings. This mirrors the error comparison behaviour of
 // https://github.com/go-test/deep,
@@ -0,0 +1,40 @@
+/*
+Copyright 2023 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+)
+
+// WriteConnectionSecretTo configures the supplied desired composed resource to
+// write its connection details to the secret with the supplied namespace and
+// name, using its spec.writeConnectionSecretToRef field. Crossplane managed
+// resources support this field.
+func WriteConnectionSecretTo(r *DesiredComposed, namespace, name string) {
+	r.Resource.SetWriteConnectionSecretToReference(&xpv1.SecretReference{Namespace: namespace, Name: name})
+}
+
+// DisableConnectionDetailsPublishing configures the supplied desired composed
+// resource not to publish its connection details, by removing its
+// spec.writeConnectionSecretToRef and spec.publishConnectionDetailsTo fields.
+// Use WriteConnectionSecretTo to publish connection details again.
+func DisableConnectionDetailsPublishing(r *DesiredComposed) {
+	unstructured.RemoveNestedField(r.Resource.Object, "spec", "writeConnectionSecretToRef")
+	unstructured.RemoveNestedField(r.Resource.Object, "spec", "publishConnectionDetailsTo")
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2023 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/crossplane/function-sdk-go/resource/composed"
+)
+
+func TestDisableConnectionDetailsPublishing(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		r      *DesiredComposed
+		want   *DesiredComposed
+	}{
+		"Published": {
+			reason: "We should remove the connection secret fields.",
+			r: &DesiredComposed{Resource: &composed.Unstructured{Unstructured: unstructured.Unstructured{Object: map[string]any{
+				"spec": map[string]any{
+					"forProvider":                map[string]any{"region": "us-east-1"},
+					"publishConnectionDetailsTo": map[string]any{"name": "cool"},
+					"writeConnectionSecretToRef": map[string]any{"namespace": "crossplane-system", "name": "cool-secret"},
+				},
+			}}}},
+			want: &DesiredComposed{Resource: &composed.Unstructured{Unstructured: unstructured.Unstructured{Object: map[string]any{
+				"spec": map[string]any{
+					"forProvider": map[string]any{"region": "us-east-1"},
+				},
+			}}}},
+		},
+		"NotPublished": {
+			reason: "We should leave a resource that doesn't publish its connection details as is.",
+			r: &DesiredComposed{Resource: &composed.Unstructured{Unstructured: unstructured.Unstructured{Object: map[string]any{
+				"spec": map[string]any{
+					"forProvider": map[string]any{"region": "us-east-1"},
+				},
+			}}}},
+			want: &DesiredComposed{Resource: &composed.Unstructured{Unstructured: unstructured.Unstructured{Object: map[string]any{
+				"spec": map[string]any{
+					"forProvider": map[string]any{"region": "us-east-1"},
+				},
+			}}}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			DisableConnectionDetailsPublishing(tc.r)
+			if diff := cmp.Diff(tc.want, tc.r); diff != "" {
+				t.Errorf("\n%s\nDisableConnectionDetailsPublishing(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestWriteConnectionSecretTo(t *testing.T) {
+	r := &DesiredComposed{Resource: &composed.Unstructured{Unstructured: unstructured.Unstructured{Object: map[string]any{}}}}
+	DisableConnectionDetailsPublishing(r)
+	WriteConnectionSecretTo(r, "crossplane-system", "cool-secret")
+
+	want := &DesiredComposed{Resource: &composed.Unstructured{Unstructured: unstructured.Unstructured{Object: map[string]any{
+		"spec": map[string]any{
+			"writeConnectionSecretToRef": map[string]any{"namespace": "crossplane-system", "name": "cool-secret"},
+		},
+	}}}}
+	if diff := cmp.Diff(want, r); diff != "" {
+		t.Errorf("WriteConnectionSecretTo(...): -want, +got:\n%s", diff)
+	}
+}
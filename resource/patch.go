@@ -0,0 +1,137 @@
+/*
+Copyright 2023 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"reflect"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/go-json-experiment/json"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/crossplane/function-sdk-go/errors"
+)
+
+// ApplyMergePatch applies the supplied JSON merge patch (RFC 7386) to the
+// supplied desired composed resource. The resource is unchanged if the patch
+// can't be applied.
+func ApplyMergePatch(r *DesiredComposed, patch []byte) error {
+	return applyPatch(r, func(doc []byte) ([]byte, error) {
+		return jsonpatch.MergePatch(doc, patch)
+	})
+}
+
+// ApplyJSONPatch applies the supplied JSON patch (RFC 6902) to the supplied
+// desired composed resource. The resource is unchanged if the patch can't be
+// applied.
+func ApplyJSONPatch(r *DesiredComposed, patch []byte) error {
+	p, err := jsonpatch.DecodePatch(patch)
+	if err != nil {
+		return errors.Wrap(err, "cannot decode JSON patch")
+	}
+	return applyPatch(r, p.Apply)
+}
+
+func applyPatch(r *DesiredComposed, apply func(doc []byte) ([]byte, error)) error {
+	doc, err := json.Marshal(r.Resource.Object)
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal desired composed resource to JSON")
+	}
+	patched, err := apply(doc)
+	if err != nil {
+		return errors.Wrap(err, "cannot apply patch to desired composed resource")
+	}
+	obj := map[string]any{}
+	if err := json.Unmarshal(patched, &obj); err != nil {
+		return errors.Wrap(err, "cannot unmarshal patched desired composed resource")
+	}
+	r.Resource.SetUnstructuredContent(obj)
+	return nil
+}
+
+// MinimalPatch returns a copy of the supplied desired resource that contains
+// only the fields that differ from the supplied observed resource, plus its
+// apiVersion, kind, and - if set - name and namespace. Nested objects are
+// compared field by field, while all other values (including arrays) are
+// compared as a whole. It returns an error if the resources are of different
+// kinds.
+//
+// Crossplane applies desired resources using server-side apply. When a
+// Function stops desiring a field it previously desired, server-side apply
+// removes it. Only use MinimalPatch for fields no Function has set before, e.g.
+// fields copied from the observed resource.
+func MinimalPatch(observed, desired *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	if observed.GetAPIVersion() != desired.GetAPIVersion() || observed.GetKind() != desired.GetKind() {
+		return nil, errors.New("observed and desired resources must have the same apiVersion and kind")
+	}
+
+	// Round-trip both resources through JSON so that equal numbers have equal
+	// types - e.g. int64 in one and float64 in the other.
+	o, err := normalize(observed.Object)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot normalize observed resource")
+	}
+	d, err := normalize(desired.Object)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot normalize desired resource")
+	}
+
+	out := &unstructured.Unstructured{Object: diffObjects(d, o)}
+	out.SetAPIVersion(desired.GetAPIVersion())
+	out.SetKind(desired.GetKind())
+	if name := desired.GetName(); name != "" {
+		out.SetName(name)
+	}
+	if ns := desired.GetNamespace(); ns != "" {
+		out.SetNamespace(ns)
+	}
+	return out, nil
+}
+
+func normalize(obj map[string]any) (map[string]any, error) {
+	j, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]any{}
+	return out, json.Unmarshal(j, &out)
+}
+
+// diffObjects returns the fields of the supplied desired object that differ
+// from the supplied observed object.
+func diffObjects(desired, observed map[string]any) map[string]any {
+	out := map[string]any{}
+	for k, dv := range desired {
+		ov, ok := observed[k]
+		if !ok {
+			out[k] = dv
+			continue
+		}
+		dm, dok := dv.(map[string]any)
+		om, ook := ov.(map[string]any)
+		if dok && ook {
+			if diff := diffObjects(dm, om); len(diff) > 0 {
+				out[k] = diff
+			}
+			continue
+		}
+		if !reflect.DeepEqual(dv, ov) {
+			out[k] = dv
+		}
+	}
+	return out
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2023 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/crossplane/function-sdk-go/resource/composed"
+)
+
+func TestApplyPatch(t *testing.T) {
+	original := func() *DesiredComposed {
+		return &DesiredComposed{Resource: &composed.Unstructured{Unstructured: unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "example.org/v1",
+			"kind":       "Cool",
+			"spec":       map[string]any{"size": "small", "zone": "a"},
+		}}}}
+	}
+
+	type want struct {
+		r   *DesiredComposed
+		err bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		apply  func(r *DesiredComposed) error
+		want   want
+	}{
+		"MergePatch": {
+			reason: "We should apply a JSON merge patch, removing fields set to null.",
+			apply: func(r *DesiredComposed) error {
+				return ApplyMergePatch(r, []byte(`{"spec":{"size":"large","zone":null}}`))
+			},
+			want: want{r: &DesiredComposed{Resource: &composed.Unstructured{Unstructured: unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": "example.org/v1",
+				"kind":       "Cool",
+				"spec":       map[string]any{"size": "large"},
+			}}}}},
+		},
+		"MalformedMergePatch": {
+			reason: "We should return an error and leave the resource unchanged if a JSON merge patch is malformed.",
+			apply: func(r *DesiredComposed) error {
+				return ApplyMergePatch(r, []byte(`{"spec":`))
+			},
+			want: want{r: original(), err: true},
+		},
+		"JSONPatch": {
+			reason: "We should apply a JSON patch.",
+			apply: func(r *DesiredComposed) error {
+				return ApplyJSONPatch(r, []byte(`[{"op":"replace","path":"/spec/size","value":"large"},{"op":"add","path":"/spec/replicas","value":3}]`))
+			},
+			want: want{r: &DesiredComposed{Resource: &composed.Unstructured{Unstructured: unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": "example.org/v1",
+				"kind":       "Cool",
+				"spec":       map[string]any{"size": "large", "zone": "a", "replicas": float64(3)},
+			}}}}},
+		},
+		"InapplicableJSONPatch": {
+			reason: "We should return an error and leave the resource unchanged if a JSON patch can't be applied.",
+			apply: func(r *DesiredComposed) error {
+				return ApplyJSONPatch(r, []byte(`[{"op":"remove","path":"/spec/missing"}]`))
+			},
+			want: want{r: original(), err: true},
+		},
+		"MalformedJSONPatch": {
+			reason: "We should return an error and leave the resource unchanged if a JSON patch is malformed.",
+			apply: func(r *DesiredComposed) error {
+				return ApplyJSONPatch(r, []byte(`{"op":"remove"}`))
+			},
+			want: want{r: original(), err: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			r := original()
+			err := tc.apply(r)
+
+			if diff := cmp.Diff(tc.want.r, r); diff != "" {
+				t.Errorf("\n%s\napply patch: -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, err != nil); diff != "" {
+				t.Errorf("\n%s\napply patch: -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestMinimalPatch(t *testing.T) {
+	observed := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "example.org/v1",
+		"kind":       "Cool",
+		"metadata":   map[string]any{"name": "cool", "labels": map[string]any{"app": "cool"}},
+		"spec": map[string]any{
+			"size":    "small",
+			"count":   float64(3),
+			"network": map[string]any{"cidr": "10.0.0.0/8", "zone": "a"},
+			"tags":    []any{"a", "b"},
+		},
+	}}
+
+	type want struct {
+		u   *unstructured.Unstructured
+		err bool
+	}
+
+	cases := map[string]struct {
+		reason  string
+		desired *unstructured.Unstructured
+		want    want
+	}{
+		"DifferentKind": {
+			reason:  "We should return an error if the resources are of different kinds.",
+			desired: &unstructured.Unstructured{Object: map[string]any{"apiVersion": "example.org/v1", "kind": "Other"}},
+			want:    want{err: true},
+		},
+		"Unchanged": {
+			reason: "We should return only identity fields if nothing changed, treating equal numbers of different types as equal.",
+			desired: &unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": "example.org/v1",
+				"kind":       "Cool",
+				"metadata":   map[string]any{"name": "cool", "labels": map[string]any{"app": "cool"}},
+				"spec":       map[string]any{"size": "small", "count": int64(3)},
+			}},
+			want: want{u: &unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": "example.org/v1",
+				"kind":       "Cool",
+				"metadata":   map[string]any{"name": "cool"},
+			}}},
+		},
+		"Changed": {
+			reason: "We should return changed and added fields, comparing nested objects field by field and arrays as a whole.",
+			desired: &unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": "example.org/v1",
+				"kind":       "Cool",
+				"spec": map[string]any{
+					"size":    "large",
+					"count":   float64(3),
+					"network": map[string]any{"cidr": "10.0.0.0/8", "zone": "b"},
+					"tags":    []any{"a", "c"},
+					"new":     true,
+				},
+			}},
+			want: want{u: &unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": "example.org/v1",
+				"kind":       "Cool",
+				"spec": map[string]any{
+					"size":    "large",
+					"network": map[string]any{"zone": "b"},
+					"tags":    []any{"a", "c"},
+					"new":     true,
+				},
+			}}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			u, err := MinimalPatch(observed, tc.desired)
+			if diff := cmp.Diff(tc.want.u, u); diff != "" {
+				t.Errorf("\n%s\nMinimalPatch(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, err != nil); diff != "" {
+				t.Errorf("\n%s\nMinimalPatch(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
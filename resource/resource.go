@@ -20,11 +20,23 @@ limitations under the License.
 package resource
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
 	"github.com/go-json-experiment/json"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/types/known/structpb"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
 
 	"github.com/crossplane/function-sdk-go/errors"
 	"github.com/crossplane/function-sdk-go/resource/composed"
@@ -35,16 +47,136 @@ import (
 // resource, for example usernames, passwords, endpoints, ports, etc.
 type ConnectionDetails map[string][]byte
 
+// AnnotationKeyCompositionResourceName is the annotation Crossplane uses to
+// record the name of a composed resource within a Composition Function
+// pipeline - i.e. its Name.
+const AnnotationKeyCompositionResourceName = "crossplane.io/composition-resource-name"
+
+// AnnotationKeyAppliedBy is the annotation SetAppliedBy uses to record the
+// name of the Function that last produced a desired composed resource.
+const AnnotationKeyAppliedBy = "fn.crossplane.io/applied-by"
+
+// ConnectionDetailsChanged compares the supplied observed connection details
+// to the supplied previous connection details. It returns the sorted keys that
+// were added, whose values changed, and that were removed.
+func ConnectionDetailsChanged(observed, previous ConnectionDetails) (added, changed, removed []string) {
+	for k, v := range observed {
+		pv, ok := previous[k]
+		switch {
+		case !ok:
+			added = append(added, k)
+		case !bytes.Equal(v, pv):
+			changed = append(changed, k)
+		}
+	}
+	for k := range previous {
+		if _, ok := observed[k]; !ok {
+			removed = append(removed, k)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(changed)
+	sort.Strings(removed)
+	return added, changed, removed
+}
+
+// ConnectionDetailFromFieldPath returns the value at the supplied field path of
+// the supplied resource as a connection detail value. String values are
+// returned as is, while other values are encoded as JSON. This is how
+// Crossplane extracts FromFieldPath connection details. If the field path
+// doesn't exist the returned error satisfies fieldpath.IsNotFound.
+func ConnectionDetailFromFieldPath(src *unstructured.Unstructured, path string) ([]byte, error) {
+	v, err := fieldpath.Pave(src.Object).GetValue(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot get connection detail from field path %q", path)
+	}
+	if s, ok := v.(string); ok {
+		return []byte(s), nil
+	}
+	b, err := json.Marshal(v)
+	return b, errors.Wrapf(err, "cannot marshal connection detail from field path %q", path)
+}
+
 // A Composite resource - aka an XR.
 type Composite struct {
 	Resource          *composite.Unstructured
 	ConnectionDetails ConnectionDetails
 }
 
+// NewDesiredComposite returns a new desired composite resource of the supplied
+// kind, with only its apiVersion and kind set. Crossplane only honors the
+// status of the desired composite resource - it ignores its metadata and spec.
+// It returns an error if the supplied kind has no version or kind.
+func NewDesiredComposite(gvk schema.GroupVersionKind) (*Composite, error) {
+	if gvk.Version == "" || gvk.Kind == "" {
+		return nil, errors.Errorf("invalid composite resource kind %q - version and kind are required", gvk)
+	}
+	xr := composite.New()
+	xr.SetGroupVersionKind(gvk)
+	return &Composite{Resource: xr, ConnectionDetails: ConnectionDetails{}}, nil
+}
+
+// IsBeingDeleted returns true if the supplied composite resource has a
+// deletion timestamp, i.e. if it is being deleted. A Function may use this to
+// avoid creating composed resources while the composite is being torn down.
+func IsBeingDeleted(c *Composite) bool {
+	if c == nil || c.Resource == nil {
+		return false
+	}
+	return c.Resource.GetDeletionTimestamp() != nil
+}
+
+// GetClaimRef returns a reference to the claim of the supplied composite
+// resource, read from its spec.claimRef. It returns false if the composite
+// resource has no claim, i.e. if it was created directly rather than by a
+// claim.
+func GetClaimRef(c *Composite) (apiVersion, kind, namespace, name string, ok bool) {
+	if c == nil || c.Resource == nil {
+		return "", "", "", "", false
+	}
+	ref := c.Resource.GetClaimReference()
+	if ref == nil || ref.Name == "" {
+		return "", "", "", "", false
+	}
+	return ref.APIVersion, ref.Kind, ref.Namespace, ref.Name, true
+}
+
+// GetCompositeSpec returns a copy of the spec of the supplied composite
+// resource. Changes to the returned map don't affect the composite resource. It
+// returns an error if the composite resource has no spec, or if its spec isn't
+// an object.
+func GetCompositeSpec(c *Composite) (map[string]any, error) {
+	if c == nil || c.Resource == nil {
+		return nil, errors.New("composite resource is nil")
+	}
+	spec, ok, err := unstructured.NestedMap(c.Resource.Object, "spec")
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get composite resource spec")
+	}
+	if !ok {
+		return nil, errors.New("composite resource has no spec")
+	}
+	return spec, nil
+}
+
 // A Name uniquely identifies a composed resource within a Composition Function
 // pipeline. It's not the resource's metadata.name.
 type Name string
 
+// DeterministicName returns a Name derived from the supplied seeds. The same
+// seeds always produce the same Name, so a Function may use it to name composed
+// resources it generates, e.g. one per element of a list in its input. The Name
+// is a valid DNS-1123 label of 16 lowercase hexadecimal characters.
+func DeterministicName(seed ...string) Name {
+	h := sha256.New()
+	for _, s := range seed {
+		// Write each seed's length before it, so that e.g. ("ab", "c") and
+		// ("a", "bc") produce different names.
+		_, _ = fmt.Fprintf(h, "%d:%s", len(s), s)
+	}
+	return Name(hex.EncodeToString(h.Sum(nil))[:16])
+}
+
 // DesiredComposed reflects the desired state of a composed resource.
 type DesiredComposed struct {
 	Resource *composed.Unstructured
@@ -72,12 +204,190 @@ func NewDesiredComposed() *DesiredComposed {
 	return &DesiredComposed{Resource: composed.New()}
 }
 
+// Sanitize removes fields that are set by the API server, or by the resource's
+// controller, from the supplied desired composed resource. These fields are
+// often accidentally carried over when a desired composed resource is built by
+// copying an observed one. A Function should not desire them.
+func Sanitize(r *DesiredComposed) {
+	if r == nil || r.Resource == nil {
+		return
+	}
+	unstructured.RemoveNestedField(r.Resource.Object, "status")
+	unstructured.RemoveNestedField(r.Resource.Object, "metadata", "resourceVersion")
+	unstructured.RemoveNestedField(r.Resource.Object, "metadata", "uid")
+	unstructured.RemoveNestedField(r.Resource.Object, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(r.Resource.Object, "metadata", "managedFields")
+}
+
+// SetAppliedBy annotates the supplied desired composed resource with the
+// supplied Function name. This makes it possible to tell which Function in a
+// multi-Function pipeline last produced a composed resource. Use GetAppliedBy
+// to read the annotation.
+func SetAppliedBy(r *DesiredComposed, functionName string) {
+	a := r.Resource.GetAnnotations()
+	if a == nil {
+		a = map[string]string{}
+	}
+	a[AnnotationKeyAppliedBy] = functionName
+	r.Resource.SetAnnotations(a)
+}
+
+// AddOwnerReference adds the supplied owner reference to the supplied desired
+// composed resource. It replaces any existing owner reference with the same
+// UID. It returns an error if the owner reference is missing its API version,
+// kind, name, or UID. Note that Crossplane adds its own owner reference to the
+// composite resource, so most Functions don't need this.
+func AddOwnerReference(r *DesiredComposed, ref metav1.OwnerReference) error {
+	if ref.APIVersion == "" || ref.Kind == "" || ref.Name == "" || ref.UID == "" {
+		return errors.Errorf("invalid owner reference %q - apiVersion, kind, name, and uid are required", ref.Name)
+	}
+	refs := r.Resource.GetOwnerReferences()
+	for i := range refs {
+		if refs[i].UID == ref.UID {
+			refs[i] = ref
+			r.Resource.SetOwnerReferences(refs)
+			return nil
+		}
+	}
+	r.Resource.SetOwnerReferences(append(refs, ref))
+	return nil
+}
+
+// GetAppliedBy returns the name of the Function that last produced the
+// supplied resource, as recorded by SetAppliedBy. It returns false if the
+// resource isn't annotated.
+func GetAppliedBy(u *unstructured.Unstructured) (string, bool) {
+	name, ok := u.GetAnnotations()[AnnotationKeyAppliedBy]
+	return name, ok
+}
+
 // ObservedComposed reflects the observed state of a composed resource.
+//
+// Crossplane only sends the observed state of composed resources that exist.
+// The RunFunctionRequest doesn't tell a Function whether a composed resource
+// failed to render or apply - such resources are simply absent from the
+// observed state.
 type ObservedComposed struct {
 	Resource          *composed.Unstructured
 	ConnectionDetails ConnectionDetails
 }
 
+// ObservedGenerationMatches returns true if the supplied resource's
+// status.observedGeneration matches its metadata.generation, i.e. if its
+// controller has reconciled the latest version of its spec. It returns false if
+// either field is absent.
+func ObservedGenerationMatches(u *unstructured.Unstructured) bool {
+	p := fieldpath.Pave(u.Object)
+	gen, ok := getGeneration(p, "metadata.generation")
+	if !ok {
+		return false
+	}
+	ogen, ok := getGeneration(p, "status.observedGeneration")
+	if !ok {
+		return false
+	}
+	return gen == ogen
+}
+
+func getGeneration(p *fieldpath.Paved, path string) (int64, bool) {
+	v, err := p.GetValue(path)
+	if err != nil {
+		return 0, false
+	}
+
+	// Generations read from a protobuf struct are float64, but those set using
+	// the unstructured helpers are int64.
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case float64:
+		return int64(n), true
+	}
+	return 0, false
+}
+
+// Well-known Crossplane condition types.
+const (
+	TypeReady  = xpv1.TypeReady
+	TypeSynced = xpv1.TypeSynced
+)
+
+// ReadyCondition returns a Ready condition with the supplied status, reason,
+// and message. Use it with response.SetDesiredCompositeConditions.
+func ReadyCondition(status corev1.ConditionStatus, reason xpv1.ConditionReason, message string) xpv1.Condition {
+	return newCondition(TypeReady, status, reason, message)
+}
+
+// SyncedCondition returns a Synced condition with the supplied status, reason,
+// and message. Use it with response.SetDesiredCompositeConditions.
+func SyncedCondition(status corev1.ConditionStatus, reason xpv1.ConditionReason, message string) xpv1.Condition {
+	return newCondition(TypeSynced, status, reason, message)
+}
+
+func newCondition(ct xpv1.ConditionType, status corev1.ConditionStatus, reason xpv1.ConditionReason, message string) xpv1.Condition {
+	return xpv1.Condition{
+		Type:               ct,
+		Status:             status,
+		LastTransitionTime: metav1.Now(),
+		Reason:             reason,
+		Message:            message,
+	}
+}
+
+// GetCondition returns the condition of the supplied type from the supplied
+// resource's status. Unlike the GetCondition method of composed resources, it
+// returns false rather than an Unknown condition if the resource has no
+// condition of the supplied type.
+func GetCondition(u *unstructured.Unstructured, ct xpv1.ConditionType) (xpv1.Condition, bool) {
+	conditioned := xpv1.ConditionedStatus{}
+	// The path is directly `status` because conditions are inline.
+	if err := fieldpath.Pave(u.Object).GetValueInto("status", &conditioned); err != nil {
+		return xpv1.Condition{}, false
+	}
+	for _, c := range conditioned.Conditions {
+		if c.Type == ct {
+			return c, true
+		}
+	}
+	return xpv1.Condition{}, false
+}
+
+// AggregateReadiness returns the readiness of a composite resource composed of
+// the supplied observed composed resources, based on their Ready conditions. It
+// returns ReadyFalse if any composed resource's Ready condition is False, or
+// ReadyTrue if every composed resource's Ready condition is True. Otherwise,
+// e.g. if a composed resource has no Ready condition yet, it returns
+// ReadyUnspecified. Like Crossplane, it considers a composite resource with no
+// composed resources to be ready.
+func AggregateReadiness(observed map[Name]ObservedComposed) Ready {
+	ready := ReadyTrue
+	for _, ocd := range observed {
+		c, _ := GetCondition(&ocd.Resource.Unstructured, xpv1.TypeReady)
+		switch c.Status {
+		case corev1.ConditionFalse:
+			return ReadyFalse
+		case corev1.ConditionTrue:
+		default:
+			ready = ReadyUnspecified
+		}
+	}
+	return ready
+}
+
+// SelectorFromLabels returns the supplied resource's labels with the supplied
+// keys. Keys the resource isn't labelled with are omitted. The result can be
+// used to select extra resources that share labels with the resource.
+func SelectorFromLabels(u *unstructured.Unstructured, keys ...string) map[string]string {
+	labels := u.GetLabels()
+	out := make(map[string]string, len(keys))
+	for _, k := range keys {
+		if v, ok := labels[k]; ok {
+			out[k] = v
+		}
+	}
+	return out
+}
+
 // AsObject gets the supplied Kubernetes object from the supplied struct.
 func AsObject(s *structpb.Struct, o runtime.Object) error {
 	// We try to avoid a JSON round-trip if o is backed by unstructured data.
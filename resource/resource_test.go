@@ -0,0 +1,673 @@
+/*
+Copyright 2023 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/utils/ptr"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane/function-sdk-go/errors"
+	"github.com/crossplane/function-sdk-go/resource/composed"
+	"github.com/crossplane/function-sdk-go/resource/composite"
+)
+
+func TestObservedGenerationMatches(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		u      *unstructured.Unstructured
+		want   bool
+	}{
+		"NoGeneration": {
+			reason: "We should return false if metadata.generation is absent.",
+			u: &unstructured.Unstructured{Object: map[string]any{
+				"status": map[string]any{"observedGeneration": float64(1)},
+			}},
+			want: false,
+		},
+		"NoObservedGeneration": {
+			reason: "We should return false if status.observedGeneration is absent.",
+			u: &unstructured.Unstructured{Object: map[string]any{
+				"metadata": map[string]any{"generation": float64(1)},
+			}},
+			want: false,
+		},
+		"Mismatch": {
+			reason: "We should return false if the generations differ.",
+			u: &unstructured.Unstructured{Object: map[string]any{
+				"metadata": map[string]any{"generation": float64(2)},
+				"status":   map[string]any{"observedGeneration": float64(1)},
+			}},
+			want: false,
+		},
+		"Match": {
+			reason: "We should return true if the generations match, regardless of their numeric type.",
+			u: &unstructured.Unstructured{Object: map[string]any{
+				"metadata": map[string]any{"generation": int64(2)},
+				"status":   map[string]any{"observedGeneration": float64(2)},
+			}},
+			want: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := ObservedGenerationMatches(tc.u)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nObservedGenerationMatches(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestReadyCondition(t *testing.T) {
+	c := ReadyCondition(corev1.ConditionFalse, xpv1.ReasonCreating, "still creating")
+	want := xpv1.Condition{
+		Type:    xpv1.TypeReady,
+		Status:  corev1.ConditionFalse,
+		Reason:  xpv1.ReasonCreating,
+		Message: "still creating",
+	}
+	if diff := cmp.Diff(want, c, cmpopts.IgnoreFields(xpv1.Condition{}, "LastTransitionTime")); diff != "" {
+		t.Errorf("ReadyCondition(...): -want, +got:\n%s", diff)
+	}
+	if c.LastTransitionTime.IsZero() {
+		t.Errorf("ReadyCondition(...): want a last transition time, got zero")
+	}
+}
+
+func TestGetCondition(t *testing.T) {
+	type want struct {
+		c  xpv1.Condition
+		ok bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		u      *unstructured.Unstructured
+		want   want
+	}{
+		"NoConditions": {
+			reason: "We should return false if the resource has no conditions.",
+			u:      &unstructured.Unstructured{Object: map[string]any{}},
+		},
+		"NoSuchCondition": {
+			reason: "We should return false if the resource has no condition of the supplied type.",
+			u: &unstructured.Unstructured{Object: map[string]any{
+				"status": map[string]any{"conditions": []any{
+					map[string]any{"type": "Synced", "status": "True"},
+				}},
+			}},
+		},
+		"Condition": {
+			reason: "We should return the condition of the supplied type.",
+			u: &unstructured.Unstructured{Object: map[string]any{
+				"status": map[string]any{"conditions": []any{
+					map[string]any{"type": "Synced", "status": "True"},
+					map[string]any{
+						"type":               "Ready",
+						"status":             "False",
+						"reason":             "Creating",
+						"message":            "still creating",
+						"lastTransitionTime": "2023-01-01T00:00:00Z",
+					},
+				}},
+			}},
+			want: want{
+				c: xpv1.Condition{
+					Type:               xpv1.TypeReady,
+					Status:             "False",
+					Reason:             xpv1.ReasonCreating,
+					Message:            "still creating",
+					LastTransitionTime: metav1.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+				},
+				ok: true,
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c, ok := GetCondition(tc.u, xpv1.TypeReady)
+			if diff := cmp.Diff(tc.want.c, c); diff != "" {
+				t.Errorf("\n%s\nGetCondition(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.ok, ok); diff != "" {
+				t.Errorf("\n%s\nGetCondition(...): -want ok, +got ok:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		r      *DesiredComposed
+		want   *DesiredComposed
+	}{
+		"Nil": {
+			reason: "Sanitizing a nil resource should be a no-op.",
+		},
+		"ServerSideFields": {
+			reason: "We should remove status and server-side metadata, but keep everything else.",
+			r: &DesiredComposed{Resource: &composed.Unstructured{Unstructured: unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": "example.org/v1",
+				"kind":       "Cool",
+				"metadata": map[string]any{
+					"name":              "cool",
+					"resourceVersion":   "42",
+					"uid":               "some-uid",
+					"creationTimestamp": "2023-01-01T00:00:00Z",
+					"managedFields":     []any{},
+				},
+				"spec":   map[string]any{"widgets": float64(9001)},
+				"status": map[string]any{"ready": true},
+			}}}},
+			want: &DesiredComposed{Resource: &composed.Unstructured{Unstructured: unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": "example.org/v1",
+				"kind":       "Cool",
+				"metadata": map[string]any{
+					"name": "cool",
+				},
+				"spec": map[string]any{"widgets": float64(9001)},
+			}}}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			Sanitize(tc.r)
+			if diff := cmp.Diff(tc.want, tc.r); diff != "" {
+				t.Errorf("\n%s\nSanitize(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestAppliedBy(t *testing.T) {
+	r := &DesiredComposed{Resource: &composed.Unstructured{Unstructured: unstructured.Unstructured{Object: map[string]any{
+		"metadata": map[string]any{"annotations": map[string]any{"existing": "annotation"}},
+	}}}}
+
+	if _, ok := GetAppliedBy(&r.Resource.Unstructured); ok {
+		t.Errorf("GetAppliedBy(...): want false before SetAppliedBy, got true")
+	}
+
+	SetAppliedBy(r, "function-cool")
+
+	name, ok := GetAppliedBy(&r.Resource.Unstructured)
+	if diff := cmp.Diff("function-cool", name); diff != "" {
+		t.Errorf("GetAppliedBy(...): -want, +got:\n%s", diff)
+	}
+	if !ok {
+		t.Errorf("GetAppliedBy(...): want true after SetAppliedBy, got false")
+	}
+	if diff := cmp.Diff("annotation", r.Resource.GetAnnotations()["existing"]); diff != "" {
+		t.Errorf("SetAppliedBy(...): existing annotations should be preserved: -want, +got:\n%s", diff)
+	}
+}
+
+func TestAddOwnerReference(t *testing.T) {
+	existing := metav1.OwnerReference{APIVersion: "example.org/v1", Kind: "Owner", Name: "a", UID: "uid-a"}
+
+	type want struct {
+		refs []metav1.OwnerReference
+		err  error
+	}
+
+	cases := map[string]struct {
+		reason string
+		ref    metav1.OwnerReference
+		want   want
+	}{
+		"Invalid": {
+			reason: "We should return an error if the owner reference is missing a required field.",
+			ref:    metav1.OwnerReference{APIVersion: "example.org/v1", Kind: "Owner", Name: "b"},
+			want: want{
+				refs: []metav1.OwnerReference{existing},
+				err:  errors.New(`invalid owner reference "b" - apiVersion, kind, name, and uid are required`),
+			},
+		},
+		"Append": {
+			reason: "We should append an owner reference with a new UID.",
+			ref:    metav1.OwnerReference{APIVersion: "example.org/v1", Kind: "Owner", Name: "b", UID: "uid-b"},
+			want: want{refs: []metav1.OwnerReference{
+				existing,
+				{APIVersion: "example.org/v1", Kind: "Owner", Name: "b", UID: "uid-b"},
+			}},
+		},
+		"Replace": {
+			reason: "We should replace an owner reference with the same UID.",
+			ref:    metav1.OwnerReference{APIVersion: "example.org/v1", Kind: "Owner", Name: "a", UID: "uid-a", Controller: ptr.To(true)},
+			want: want{refs: []metav1.OwnerReference{
+				{APIVersion: "example.org/v1", Kind: "Owner", Name: "a", UID: "uid-a", Controller: ptr.To(true)},
+			}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			r := NewDesiredComposed()
+			r.Resource.SetOwnerReferences([]metav1.OwnerReference{existing})
+			err := AddOwnerReference(r, tc.ref)
+			if diff := cmp.Diff(tc.want.refs, r.Resource.GetOwnerReferences()); diff != "" {
+				t.Errorf("\n%s\nAddOwnerReference(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nAddOwnerReference(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestAggregateReadiness(t *testing.T) {
+	withReady := func(status corev1.ConditionStatus) ObservedComposed {
+		cd := composed.New()
+		cd.SetConditions(xpv1.Condition{Type: xpv1.TypeReady, Status: status})
+		return ObservedComposed{Resource: cd}
+	}
+
+	cases := map[string]struct {
+		reason   string
+		observed map[Name]ObservedComposed
+		want     Ready
+	}{
+		"Empty": {
+			reason: "A composite with no composed resources should be ready.",
+			want:   ReadyTrue,
+		},
+		"AllReady": {
+			reason: "A composite should be ready if all of its composed resources are ready.",
+			observed: map[Name]ObservedComposed{
+				"a": withReady(corev1.ConditionTrue),
+				"b": withReady(corev1.ConditionTrue),
+			},
+			want: ReadyTrue,
+		},
+		"OneNotReady": {
+			reason: "A composite should not be ready if any of its composed resources isn't ready.",
+			observed: map[Name]ObservedComposed{
+				"a": withReady(corev1.ConditionTrue),
+				"b": withReady(corev1.ConditionUnknown),
+				"c": withReady(corev1.ConditionFalse),
+			},
+			want: ReadyFalse,
+		},
+		"NoCondition": {
+			reason: "Readiness should be unspecified if a composed resource has no Ready condition.",
+			observed: map[Name]ObservedComposed{
+				"a": withReady(corev1.ConditionTrue),
+				"b": {Resource: composed.New()},
+			},
+			want: ReadyUnspecified,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := AggregateReadiness(tc.observed)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nAggregateReadiness(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestSelectorFromLabels(t *testing.T) {
+	type args struct {
+		u    *unstructured.Unstructured
+		keys []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   map[string]string
+	}{
+		"NoLabels": {
+			reason: "We should return an empty selector if the resource has no labels.",
+			args: args{
+				u:    &unstructured.Unstructured{Object: map[string]any{}},
+				keys: []string{"app"},
+			},
+			want: map[string]string{},
+		},
+		"SomeLabels": {
+			reason: "We should return only the requested labels the resource actually has.",
+			args: args{
+				u: &unstructured.Unstructured{Object: map[string]any{
+					"metadata": map[string]any{
+						"labels": map[string]any{
+							"app":  "cool",
+							"tier": "web",
+						},
+					},
+				}},
+				keys: []string{"app", "region"},
+			},
+			want: map[string]string{"app": "cool"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := SelectorFromLabels(tc.args.u, tc.args.keys...)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nSelectorFromLabels(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestConnectionDetailFromFieldPath(t *testing.T) {
+	u := &unstructured.Unstructured{Object: map[string]any{
+		"status": map[string]any{
+			"endpoint": "db.example.org",
+			"port":     float64(5432),
+		},
+	}}
+
+	type want struct {
+		b        []byte
+		notFound bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		path   string
+		want   want
+	}{
+		"NotFound": {
+			reason: "We should return a not found error if the field path doesn't exist.",
+			path:   "status.password",
+			want:   want{notFound: true},
+		},
+		"String": {
+			reason: "We should return string values as is.",
+			path:   "status.endpoint",
+			want:   want{b: []byte("db.example.org")},
+		},
+		"NotString": {
+			reason: "We should return other values encoded as JSON.",
+			path:   "status.port",
+			want:   want{b: []byte("5432")},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			b, err := ConnectionDetailFromFieldPath(u, tc.path)
+			if diff := cmp.Diff(tc.want.b, b); diff != "" {
+				t.Errorf("\n%s\nConnectionDetailFromFieldPath(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.notFound, fieldpath.IsNotFound(err)); diff != "" {
+				t.Errorf("\n%s\nConnectionDetailFromFieldPath(...): -want not found, +got not found:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestNewDesiredComposite(t *testing.T) {
+	type want struct {
+		c   *Composite
+		err error
+	}
+
+	cases := map[string]struct {
+		reason string
+		gvk    schema.GroupVersionKind
+		want   want
+	}{
+		"NoKind": {
+			reason: "We should return an error if the kind is empty.",
+			gvk:    schema.GroupVersionKind{Group: "example.org", Version: "v1"},
+			want:   want{err: errors.New(`invalid composite resource kind "example.org/v1, Kind=" - version and kind are required`)},
+		},
+		"Composite": {
+			reason: "We should return a composite with only the supplied kind set.",
+			gvk:    schema.GroupVersionKind{Group: "example.org", Version: "v1", Kind: "XCool"},
+			want: want{c: &Composite{
+				Resource: &composite.Unstructured{Unstructured: unstructured.Unstructured{Object: map[string]any{
+					"apiVersion": "example.org/v1",
+					"kind":       "XCool",
+				}}},
+				ConnectionDetails: ConnectionDetails{},
+			}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c, err := NewDesiredComposite(tc.gvk)
+			if diff := cmp.Diff(tc.want.c, c); diff != "" {
+				t.Errorf("\n%s\nNewDesiredComposite(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nNewDesiredComposite(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestIsBeingDeleted(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		c      *Composite
+		want   bool
+	}{
+		"Nil": {
+			reason: "A nil composite is not being deleted.",
+			want:   false,
+		},
+		"NotBeingDeleted": {
+			reason: "A composite without a deletion timestamp is not being deleted.",
+			c:      &Composite{Resource: composite.New()},
+			want:   false,
+		},
+		"BeingDeleted": {
+			reason: "A composite with a deletion timestamp is being deleted.",
+			c: &Composite{Resource: &composite.Unstructured{Unstructured: unstructured.Unstructured{Object: map[string]any{
+				"metadata": map[string]any{"deletionTimestamp": "2023-01-01T00:00:00Z"},
+			}}}},
+			want: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := IsBeingDeleted(tc.c)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nIsBeingDeleted(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestGetClaimRef(t *testing.T) {
+	type want struct {
+		apiVersion string
+		kind       string
+		namespace  string
+		name       string
+		ok         bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		c      *Composite
+		want   want
+	}{
+		"NoClaim": {
+			reason: "We should return false if the composite has no claim.",
+			c:      &Composite{Resource: composite.New()},
+		},
+		"Claim": {
+			reason: "We should return the composite's claim reference.",
+			c: &Composite{Resource: &composite.Unstructured{Unstructured: unstructured.Unstructured{Object: map[string]any{
+				"spec": map[string]any{"claimRef": map[string]any{
+					"apiVersion": "example.org/v1",
+					"kind":       "Cool",
+					"namespace":  "default",
+					"name":       "cool-claim",
+				}},
+			}}}},
+			want: want{apiVersion: "example.org/v1", kind: "Cool", namespace: "default", name: "cool-claim", ok: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var got want
+			got.apiVersion, got.kind, got.namespace, got.name, got.ok = GetClaimRef(tc.c)
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("\n%s\nGetClaimRef(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestGetCompositeSpec(t *testing.T) {
+	type want struct {
+		spec map[string]any
+		err  error
+	}
+
+	cases := map[string]struct {
+		reason string
+		c      *Composite
+		want   want
+	}{
+		"NoSpec": {
+			reason: "We should return an error if the composite has no spec.",
+			c:      &Composite{Resource: composite.New()},
+			want:   want{err: errors.New("composite resource has no spec")},
+		},
+		"Spec": {
+			reason: "We should return the composite's spec.",
+			c: &Composite{Resource: &composite.Unstructured{Unstructured: unstructured.Unstructured{Object: map[string]any{
+				"spec": map[string]any{"widgets": float64(3), "tags": []any{"a"}},
+			}}}},
+			want: want{spec: map[string]any{"widgets": float64(3), "tags": []any{"a"}}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			spec, err := GetCompositeSpec(tc.c)
+			if diff := cmp.Diff(tc.want.spec, spec); diff != "" {
+				t.Errorf("\n%s\nGetCompositeSpec(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nGetCompositeSpec(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+
+	t.Run("Copy", func(t *testing.T) {
+		c := &Composite{Resource: &composite.Unstructured{Unstructured: unstructured.Unstructured{Object: map[string]any{
+			"spec": map[string]any{"nested": map[string]any{"widgets": float64(3)}},
+		}}}}
+		spec, err := GetCompositeSpec(c)
+		if err != nil {
+			t.Fatalf("GetCompositeSpec(...): unexpected error: %v", err)
+		}
+		spec["nested"].(map[string]any)["widgets"] = float64(4)
+		want := map[string]any{"nested": map[string]any{"widgets": float64(3)}}
+		if diff := cmp.Diff(want, c.Resource.Object["spec"]); diff != "" {
+			t.Errorf("GetCompositeSpec(...): modifying the returned spec changed the composite: -want, +got:\n%s", diff)
+		}
+	})
+}
+
+func TestConnectionDetailsChanged(t *testing.T) {
+	type args struct {
+		observed ConnectionDetails
+		previous ConnectionDetails
+	}
+	type want struct {
+		added   []string
+		changed []string
+		removed []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"Unchanged": {
+			reason: "Identical connection details should not report any changes.",
+			args: args{
+				observed: ConnectionDetails{"a": []byte("1")},
+				previous: ConnectionDetails{"a": []byte("1")},
+			},
+			want: want{},
+		},
+		"Changed": {
+			reason: "We should report added, changed, and removed keys.",
+			args: args{
+				observed: ConnectionDetails{"a": []byte("1"), "b": []byte("2"), "c": []byte("3"), "d": []byte("4")},
+				previous: ConnectionDetails{"a": []byte("1"), "b": []byte("1"), "e": []byte("5")},
+			},
+			want: want{
+				added:   []string{"c", "d"},
+				changed: []string{"b"},
+				removed: []string{"e"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			added, changed, removed := ConnectionDetailsChanged(tc.args.observed, tc.args.previous)
+			if diff := cmp.Diff(tc.want.added, added); diff != "" {
+				t.Errorf("\n%s\nConnectionDetailsChanged(...): -want added, +got added:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.changed, changed); diff != "" {
+				t.Errorf("\n%s\nConnectionDetailsChanged(...): -want changed, +got changed:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.removed, removed); diff != "" {
+				t.Errorf("\n%s\nConnectionDetailsChanged(...): -want removed, +got removed:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestDeterministicName(t *testing.T) {
+	a := DeterministicName("ab", "c")
+	if diff := cmp.Diff(a, DeterministicName("ab", "c")); diff != "" {
+		t.Errorf("DeterministicName(...): the same seeds should produce the same name: -want, +got:\n%s", diff)
+	}
+	if b := DeterministicName("a", "bc"); a == b {
+		t.Errorf("DeterministicName(...): different seeds should produce different names, got %q for both", a)
+	}
+	if errs := validation.IsDNS1123Label(string(a)); len(errs) > 0 {
+		t.Errorf("DeterministicName(...): %q is not a valid DNS-1123 label: %v", a, errs)
+	}
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2023 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"text/template"
+
+	kyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+
+	"github.com/crossplane/function-sdk-go/errors"
+)
+
+// RenderTemplate executes the supplied Go template with the supplied data, and
+// returns the desired composed resources it produces. The template must produce
+// a stream of YAML documents separated by "---", each of which is a resource.
+// Empty documents are ignored. Data is typically the RunFunctionRequest, so the
+// template can use the observed and desired state and the context. It returns
+// an error if a document isn't a resource with an apiVersion and kind.
+func RenderTemplate(tmpl string, data any) ([]*DesiredComposed, error) {
+	t, err := template.New("resources").Parse(tmpl)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse template")
+	}
+	buf := &bytes.Buffer{}
+	if err := t.Execute(buf, data); err != nil {
+		return nil, errors.Wrap(err, "cannot execute template")
+	}
+
+	out := make([]*DesiredComposed, 0)
+	r := kyaml.NewYAMLReader(bufio.NewReader(buf))
+	for i := 0; ; i++ {
+		doc, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return out, nil
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot read rendered document %d", i)
+		}
+		obj := map[string]any{}
+		if err := yaml.Unmarshal(doc, &obj); err != nil {
+			return nil, errors.Wrapf(err, "cannot unmarshal rendered document %d", i)
+		}
+		if len(obj) == 0 {
+			continue
+		}
+		dcd := NewDesiredComposed()
+		dcd.Resource.SetUnstructuredContent(obj)
+		if dcd.Resource.GetAPIVersion() == "" || dcd.Resource.GetKind() == "" {
+			return nil, errors.Errorf("rendered document %d is not a resource - apiVersion and kind are required", i)
+		}
+		out = append(out, dcd)
+	}
+}
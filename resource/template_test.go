@@ -0,0 +1,93 @@
+/*
+Copyright 2023 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/crossplane/function-sdk-go/resource/composed"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	type args struct {
+		tmpl string
+		data any
+	}
+	type want struct {
+		out []*DesiredComposed
+		err bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"InvalidTemplate": {
+			reason: "We should return an error if the template can't be parsed.",
+			args:   args{tmpl: "{{ .Name"},
+			want:   want{err: true},
+		},
+		"MissingKind": {
+			reason: "We should return an error if a rendered document isn't a resource.",
+			args:   args{tmpl: "apiVersion: v1\nmetadata:\n  name: cool\n"},
+			want:   want{err: true},
+		},
+		"Success": {
+			reason: "We should return a desired composed resource for each non-empty rendered document.",
+			args: args{
+				tmpl: `---
+{{- range .Names }}
+apiVersion: example.org/v1
+kind: Bucket
+metadata:
+  name: {{ . }}
+---
+{{- end }}
+`,
+				data: map[string]any{"Names": []string{"a", "b"}},
+			},
+			want: want{out: []*DesiredComposed{
+				{Resource: &composed.Unstructured{Unstructured: unstructured.Unstructured{Object: map[string]any{
+					"apiVersion": "example.org/v1",
+					"kind":       "Bucket",
+					"metadata":   map[string]any{"name": "a"},
+				}}}},
+				{Resource: &composed.Unstructured{Unstructured: unstructured.Unstructured{Object: map[string]any{
+					"apiVersion": "example.org/v1",
+					"kind":       "Bucket",
+					"metadata":   map[string]any{"name": "b"},
+				}}}},
+			}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			out, err := RenderTemplate(tc.args.tmpl, tc.args.data)
+			if diff := cmp.Diff(tc.want.out, out); diff != "" {
+				t.Errorf("\n%s\nRenderTemplate(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, err != nil); diff != "" {
+				t.Errorf("\n%s\nRenderTemplate(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
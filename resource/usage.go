@@ -0,0 +1,94 @@
+/*
+Copyright 2023 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"github.com/crossplane/function-sdk-go/errors"
+	"github.com/crossplane/function-sdk-go/resource/composed"
+)
+
+// Usage API version and kind.
+const (
+	UsageAPIVersion = "apiextensions.crossplane.io/v1alpha1"
+	UsageKind       = "Usage"
+)
+
+// NewUsage returns a desired Usage, which prevents the composed resource named
+// of from being deleted while the composed resource named by uses it. Both
+// resources must exist in the supplied desired composed resources, and must
+// have an API version and kind.
+//
+// A composed resource is referenced by its name if it has one. Otherwise it is
+// selected by its labels, and by being controlled by the same composite
+// resource as the Usage.
+func NewUsage(dcds map[Name]*DesiredComposed, of, by Name) (*DesiredComposed, error) {
+	if of == by {
+		return nil, errors.Errorf("composed resource %q cannot use itself", of)
+	}
+	ofr, err := usageResource(dcds, of)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid used resource")
+	}
+	byr, err := usageResource(dcds, by)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid using resource")
+	}
+
+	u := composed.New()
+	u.SetAPIVersion(UsageAPIVersion)
+	u.SetKind(UsageKind)
+	if err := u.SetValue("spec.of", ofr); err != nil {
+		return nil, errors.Wrap(err, "cannot set used resource")
+	}
+	if err := u.SetValue("spec.by", byr); err != nil {
+		return nil, errors.Wrap(err, "cannot set using resource")
+	}
+	return &DesiredComposed{Resource: u}, nil
+}
+
+func usageResource(dcds map[Name]*DesiredComposed, name Name) (map[string]any, error) {
+	dcd, ok := dcds[name]
+	if !ok || dcd == nil || dcd.Resource == nil {
+		return nil, errors.Errorf("composed resource %q is not desired", name)
+	}
+	if dcd.Resource.GetAPIVersion() == "" || dcd.Resource.GetKind() == "" {
+		return nil, errors.Errorf("composed resource %q has no API version or kind", name)
+	}
+
+	r := map[string]any{
+		"apiVersion": dcd.Resource.GetAPIVersion(),
+		"kind":       dcd.Resource.GetKind(),
+	}
+	if n := dcd.Resource.GetName(); n != "" {
+		r["resourceRef"] = map[string]any{"name": n}
+		return r, nil
+	}
+
+	l := dcd.Resource.GetLabels()
+	if len(l) == 0 {
+		return nil, errors.Errorf("composed resource %q has no name or labels to reference it by", name)
+	}
+	ml := make(map[string]any, len(l))
+	for k, v := range l {
+		ml[k] = v
+	}
+	r["resourceSelector"] = map[string]any{
+		"matchControllerRef": true,
+		"matchLabels":        ml,
+	}
+	return r, nil
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2023 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane/function-sdk-go/errors"
+	"github.com/crossplane/function-sdk-go/resource/composed"
+)
+
+func TestNewUsage(t *testing.T) {
+	dcds := map[Name]*DesiredComposed{
+		"named": {Resource: &composed.Unstructured{Unstructured: unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "example.org/v1",
+			"kind":       "Database",
+			"metadata":   map[string]any{"name": "cool-db"},
+		}}}},
+		"labelled": {Resource: &composed.Unstructured{Unstructured: unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "example.org/v1",
+			"kind":       "App",
+			"metadata":   map[string]any{"labels": map[string]any{"app": "cool"}},
+		}}}},
+		"anonymous": {Resource: &composed.Unstructured{Unstructured: unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "example.org/v1",
+			"kind":       "App",
+		}}}},
+	}
+
+	type args struct {
+		of Name
+		by Name
+	}
+	type want struct {
+		u   *DesiredComposed
+		err error
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"Self": {
+			reason: "A resource cannot use itself.",
+			args:   args{of: "named", by: "named"},
+			want:   want{err: errors.New(`composed resource "named" cannot use itself`)},
+		},
+		"NotDesired": {
+			reason: "Both resources must be desired.",
+			args:   args{of: "missing", by: "named"},
+			want:   want{err: errors.Wrap(errors.New(`composed resource "missing" is not desired`), "invalid used resource")},
+		},
+		"Unreferenceable": {
+			reason: "Both resources must have a name or labels.",
+			args:   args{of: "named", by: "anonymous"},
+			want:   want{err: errors.Wrap(errors.New(`composed resource "anonymous" has no name or labels to reference it by`), "invalid using resource")},
+		},
+		"Usage": {
+			reason: "We should reference named resources by name, and others by selector.",
+			args:   args{of: "named", by: "labelled"},
+			want: want{u: &DesiredComposed{Resource: &composed.Unstructured{Unstructured: unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": UsageAPIVersion,
+				"kind":       UsageKind,
+				"spec": map[string]any{
+					"of": map[string]any{
+						"apiVersion":  "example.org/v1",
+						"kind":        "Database",
+						"resourceRef": map[string]any{"name": "cool-db"},
+					},
+					"by": map[string]any{
+						"apiVersion": "example.org/v1",
+						"kind":       "App",
+						"resourceSelector": map[string]any{
+							"matchControllerRef": true,
+							"matchLabels":        map[string]any{"app": "cool"},
+						},
+					},
+				},
+			}}}}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			u, err := NewUsage(dcds, tc.args.of, tc.args.by)
+			if diff := cmp.Diff(tc.want.u, u); diff != "" {
+				t.Errorf("\n%s\nNewUsage(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nNewUsage(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
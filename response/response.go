@@ -18,20 +18,44 @@ limitations under the License.
 package response
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
 	"time"
 
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/structpb"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+
+	fncontext "github.com/crossplane/function-sdk-go/context"
 	"github.com/crossplane/function-sdk-go/errors"
 	"github.com/crossplane/function-sdk-go/proto/v1beta1"
 	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/resource/composed"
+	"github.com/crossplane/function-sdk-go/resource/composite"
 )
 
 // DefaultTTL is the default TTL for which a response can be cached.
 const DefaultTTL = 1 * time.Minute
 
+// ErrorTTL is the TTL TTLForResults returns for a response with fatal or
+// warning results.
+const ErrorTTL = 10 * time.Second
+
 // To bootstraps a response to the supplied request. It automatically copies the
 // desired state from the request.
 func To(req *v1beta1.RunFunctionRequest, ttl time.Duration) *v1beta1.RunFunctionResponse {
@@ -45,6 +69,76 @@ func To(req *v1beta1.RunFunctionRequest, ttl time.Duration) *v1beta1.RunFunction
 	}
 }
 
+// Passthrough returns a response to the supplied request that makes no changes.
+// It passes through the desired state and context from the request unchanged,
+// and has no results. Use it when a Function has nothing to contribute, to
+// avoid accidentally dropping the desired state accumulated by previous
+// Functions in the pipeline.
+func Passthrough(req *v1beta1.RunFunctionRequest, ttl time.Duration) *v1beta1.RunFunctionResponse {
+	return To(req, ttl)
+}
+
+// ToObserveOnly bootstraps a response to the supplied request for a Function
+// that only reads observed state, and only emits results and context - for
+// example a policy check. The response's desired state is a copy of the
+// request's, so that AssertDesiredUnchanged can catch accidental writes.
+//
+// Note that an observe-only Function must still return the desired state it
+// was sent. Crossplane replaces the pipeline's desired state with whatever each
+// Function returns, so omitting it would delete all composed resources.
+func ToObserveOnly(req *v1beta1.RunFunctionRequest, ttl time.Duration) *v1beta1.RunFunctionResponse {
+	rsp := To(req, ttl)
+	if req.GetDesired() != nil {
+		rsp.Desired = proto.Clone(req.GetDesired()).(*v1beta1.State) //nolint:forcetypeassert // Clone always returns the type it's passed.
+	}
+	return rsp
+}
+
+// AssertDesiredUnchanged returns an error if the desired state of the supplied
+// response differs from that of the supplied request. Use it with
+// ToObserveOnly to ensure an observe-only Function never changes the
+// composite or composed resources.
+func AssertDesiredUnchanged(rsp *v1beta1.RunFunctionResponse, req *v1beta1.RunFunctionRequest) error {
+	if !proto.Equal(rsp.GetDesired(), req.GetDesired()) {
+		return errors.New("observe-only response changed the desired state")
+	}
+	return nil
+}
+
+// RequeueAfter sets the TTL of the supplied response to the supplied duration.
+// Use it to indicate that the Function should be called again soon, for
+// example because it's waiting on an external dependency that isn't ready yet.
+// Crossplane may cache a response until its TTL expires, so a short TTL ensures
+// the Function is run again when the composite resource is next reconciled.
+// Note that the TTL doesn't trigger a reconcile itself; Crossplane will still
+// only reconcile the composite resource at its configured poll interval, or
+// when it or a composed resource changes. Use Normal or Normalf to explain
+// what the Function is waiting for.
+func RequeueAfter(rsp *v1beta1.RunFunctionResponse, d time.Duration) {
+	if rsp.GetMeta() == nil {
+		rsp.Meta = &v1beta1.ResponseMeta{}
+	}
+	rsp.Meta.Ttl = durationpb.New(d)
+}
+
+// TTLForResults returns the TTL for which the supplied response should be
+// cached. It returns ErrorTTL, or the supplied default if it's shorter, if the
+// response has any fatal or warning results. Otherwise it returns the supplied
+// default. The condition that caused a fatal or warning result may resolve
+// soon, so a response that has them shouldn't be cached for as long as one that
+// doesn't. For example:
+//
+//	RequeueAfter(rsp, TTLForResults(rsp, DefaultTTL))
+func TTLForResults(rsp *v1beta1.RunFunctionResponse, def time.Duration) time.Duration {
+	for _, r := range rsp.GetResults() {
+		switch r.GetSeverity() {
+		case v1beta1.Severity_SEVERITY_FATAL, v1beta1.Severity_SEVERITY_WARNING:
+			return min(ErrorTTL, def)
+		}
+	}
+	return def
+}
+
 // SetContextKey sets context to the supplied key.
 func SetContextKey(rsp *v1beta1.RunFunctionResponse, key string, v *structpb.Value) {
 	if rsp.GetContext().GetFields() == nil {
@@ -53,6 +147,49 @@ func SetContextKey(rsp *v1beta1.RunFunctionResponse, key string, v *structpb.Val
 	rsp.Context.Fields[key] = v
 }
 
+// SetContextBytes sets the supplied bytes as context at the supplied key.
+// The bytes are encoded as a string using standard, padded base64 encoding (RFC
+// 4648), which is also how protobuf JSON encodes bytes. Use
+// request.GetContextBytes to read them.
+func SetContextBytes(rsp *v1beta1.RunFunctionResponse, key string, b []byte) {
+	SetContextKey(rsp, key, structpb.NewStringValue(base64.StdEncoding.EncodeToString(b)))
+}
+
+// SetEnvironment sets the supplied Composition Environment in the context of
+// the supplied response, replacing any existing environment. Use
+// request.GetEnvironment to read the environment.
+func SetEnvironment(rsp *v1beta1.RunFunctionResponse, env *unstructured.Unstructured) error {
+	s, err := resource.AsStruct(env)
+	if err != nil {
+		return errors.Wrap(err, "cannot convert environment to struct")
+	}
+	SetContextKey(rsp, fncontext.KeyEnvironment, structpb.NewStructValue(s))
+	return nil
+}
+
+// SetDebug records the supplied value as a debugging artifact with the supplied
+// key, for example an intermediate value or a rendered template. Tools like
+// crossplane beta render can display debugging artifacts, which are recorded in
+// the context key fncontext.KeyDebug. They're stripped from the response unless
+// the Function is served using the WithDebug option, so they never reach
+// Crossplane in production. Debugging artifacts must not contain secrets.
+func SetDebug(rsp *v1beta1.RunFunctionResponse, key string, v any) error {
+	dv, err := structpb.NewValue(v)
+	if err != nil {
+		return errors.Wrapf(err, "cannot convert debugging artifact %q to a protobuf value", key)
+	}
+	d := rsp.GetContext().GetFields()[fncontext.KeyDebug].GetStructValue()
+	if d == nil {
+		d = &structpb.Struct{}
+	}
+	if d.Fields == nil {
+		d.Fields = map[string]*structpb.Value{}
+	}
+	d.Fields[key] = dv
+	SetContextKey(rsp, fncontext.KeyDebug, structpb.NewStructValue(d))
+	return nil
+}
+
 // SetDesiredCompositeResource sets the desired composite resource in the
 // supplied response. The caller must be sure to avoid overwriting the desired
 // state that may have been accumulated by previous Functions in the pipeline,
@@ -66,6 +203,173 @@ func SetDesiredCompositeResource(rsp *v1beta1.RunFunctionResponse, xr *resource.
 	return errors.Wrapf(err, "cannot convert %T to desired composite resource", xr.Resource)
 }
 
+// SetDesiredCompositeConditions sets the supplied conditions on the desired
+// composite resource in the supplied response. Each condition records that it
+// reflects the generation of the supplied observed composite resource, so that
+// consumers can tell whether the condition is stale. Use the desired composite
+// resource's SetConditionsWithObservedGeneration method to record a different
+// generation. Use resource.ReadyCondition and resource.SyncedCondition to build
+// the well-known conditions.
+func SetDesiredCompositeConditions(rsp *v1beta1.RunFunctionResponse, oxr *resource.Composite, c ...xpv1.Condition) error {
+	dxr, err := getDesiredCompositeResource(rsp)
+	if err != nil {
+		return err
+	}
+	dxr.Resource.SetConditionsWithObservedGeneration(oxr.Resource.GetGeneration(), c...)
+	return SetDesiredCompositeResource(rsp, dxr)
+}
+
+// SetDesiredCompositeStatus sets the supplied fields of the desired composite
+// resource's status in the supplied response. Each top-level status field is
+// replaced, while other status fields (e.g. conditions) are preserved. The rest
+// of the desired composite resource is unchanged.
+func SetDesiredCompositeStatus(rsp *v1beta1.RunFunctionResponse, status map[string]any) error {
+	dxr, err := getDesiredCompositeResource(rsp)
+	if err != nil {
+		return err
+	}
+	for k, v := range status {
+		if err := dxr.Resource.SetValue(fmt.Sprintf("status[%s]", k), v); err != nil {
+			return errors.Wrapf(err, "cannot set desired composite resource status field %q", k)
+		}
+	}
+	return SetDesiredCompositeResource(rsp, dxr)
+}
+
+// PreserveCompositeStatus copies the status of the observed composite resource
+// in the supplied request to the desired composite resource in the supplied
+// response. Status fields the desired composite resource already sets take
+// precedence. Use it to avoid dropping status fields set by another Function in
+// the pipeline when building the desired composite resource from scratch.
+func PreserveCompositeStatus(rsp *v1beta1.RunFunctionResponse, req *v1beta1.RunFunctionRequest) error {
+	oxr := composite.New()
+	if err := resource.AsObject(req.GetObserved().GetComposite().GetResource(), oxr); err != nil {
+		return errors.Wrap(err, "cannot get observed composite resource")
+	}
+	ostatus, _ := oxr.Object["status"].(map[string]any)
+	if len(ostatus) == 0 {
+		return nil
+	}
+	dxr, err := getDesiredCompositeResource(rsp)
+	if err != nil {
+		return err
+	}
+	dstatus, _ := dxr.Resource.Object["status"].(map[string]any)
+	dxr.Resource.Object["status"] = mergeStatus(ostatus, dstatus)
+	return SetDesiredCompositeResource(rsp, dxr)
+}
+
+// PreserveCompositeStatusFields is like PreserveCompositeStatus, but only
+// copies the supplied status field paths, e.g. status.network.id. Field paths
+// that the observed composite resource doesn't have, or that the desired
+// composite resource already sets, are left unchanged. It returns an error if a
+// field path is invalid.
+func PreserveCompositeStatusFields(rsp *v1beta1.RunFunctionResponse, req *v1beta1.RunFunctionRequest, paths ...string) error {
+	oxr := composite.New()
+	if err := resource.AsObject(req.GetObserved().GetComposite().GetResource(), oxr); err != nil {
+		return errors.Wrap(err, "cannot get observed composite resource")
+	}
+	dxr, err := getDesiredCompositeResource(rsp)
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		_, err := dxr.Resource.GetValue(p)
+		if err == nil {
+			continue
+		}
+		if !fieldpath.IsNotFound(err) {
+			return errors.Wrapf(err, "cannot get desired composite resource field %q", p)
+		}
+		v, err := oxr.GetValue(p)
+		if fieldpath.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "cannot get observed composite resource field %q", p)
+		}
+		if err := dxr.Resource.SetValue(p, v); err != nil {
+			return errors.Wrapf(err, "cannot set desired composite resource field %q", p)
+		}
+	}
+	return SetDesiredCompositeResource(rsp, dxr)
+}
+
+// mergeStatus merges the supplied desired status over the supplied observed
+// status. Nested objects are merged, while all other desired values (including
+// arrays) replace the observed value.
+func mergeStatus(observed, desired map[string]any) map[string]any {
+	for k, dv := range desired {
+		dm, dok := dv.(map[string]any)
+		om, ook := observed[k].(map[string]any)
+		if dok && ook {
+			observed[k] = mergeStatus(om, dm)
+			continue
+		}
+		observed[k] = dv
+	}
+	return observed
+}
+
+// CompositeChanged returns true if the desired composite resource in the
+// supplied response would change the status of the observed composite resource
+// in the supplied request. Crossplane ignores the metadata and spec of the
+// desired composite resource, and only applies its status. Only status fields
+// the desired composite resource sets are compared - fields it omits are left
+// unchanged. It returns false if there is no observed composite resource.
+func CompositeChanged(rsp *v1beta1.RunFunctionResponse, req *v1beta1.RunFunctionRequest) (bool, error) {
+	if req.GetObserved().GetComposite().GetResource() == nil {
+		return false, nil
+	}
+	oxr := composite.New()
+	if err := resource.AsObject(req.GetObserved().GetComposite().GetResource(), oxr); err != nil {
+		return false, errors.Wrap(err, "cannot get observed composite resource")
+	}
+	dxr, err := getDesiredCompositeResource(rsp)
+	if err != nil {
+		return false, err
+	}
+	ostatus, _ := oxr.Object["status"].(map[string]any)
+	dstatus, _ := dxr.Resource.Object["status"].(map[string]any)
+	return !appliesCleanly(dstatus, ostatus), nil
+}
+
+// appliesCleanly returns true if every field of the supplied desired object is
+// equal to the corresponding field of the supplied observed object. Nested
+// objects are compared field by field, while all other values (including
+// arrays) are compared as a whole.
+func appliesCleanly(desired, observed map[string]any) bool {
+	for k, dv := range desired {
+		ov, ok := observed[k]
+		if !ok {
+			return false
+		}
+		dm, dok := dv.(map[string]any)
+		om, ook := ov.(map[string]any)
+		if dok && ook {
+			if !appliesCleanly(dm, om) {
+				return false
+			}
+			continue
+		}
+		if !reflect.DeepEqual(dv, ov) {
+			return false
+		}
+	}
+	return true
+}
+
+// getDesiredCompositeResource from the supplied response.
+func getDesiredCompositeResource(rsp *v1beta1.RunFunctionResponse) (*resource.Composite, error) {
+	dxr := &resource.Composite{Resource: composite.New(), ConnectionDetails: rsp.GetDesired().GetComposite().GetConnectionDetails()}
+	if s := rsp.GetDesired().GetComposite().GetResource(); s != nil {
+		if err := resource.AsObject(s, dxr.Resource); err != nil {
+			return nil, errors.Wrap(err, "cannot get desired composite resource")
+		}
+	}
+	return dxr, nil
+}
+
 // SetDesiredComposedResources sets the desired composed resources in the
 // supplied response. The caller must be sure to avoid overwriting the desired
 // state that may have been accumulated by previous Functions in the pipeline,
@@ -96,6 +400,576 @@ func SetDesiredComposedResources(rsp *v1beta1.RunFunctionResponse, dcds map[reso
 	return nil
 }
 
+// SetNamespaceOnDesiredComposed sets the supplied namespace on every desired
+// composed resource in the supplied response that is of one of the supplied
+// namespaced kinds, and doesn't already have a namespace. A Function can't tell
+// whether an arbitrary kind is namespaced, and most composed resources - e.g.
+// managed resources - are cluster scoped, so resources of any other kind are
+// left as is.
+func SetNamespaceOnDesiredComposed(rsp *v1beta1.RunFunctionResponse, namespace string, namespaced ...schema.GroupKind) {
+	ns := make(map[schema.GroupKind]bool, len(namespaced))
+	for _, gk := range namespaced {
+		ns[gk] = true
+	}
+
+	for _, r := range rsp.GetDesired().GetResources() {
+		f := r.GetResource().GetFields()
+		if f == nil {
+			continue
+		}
+		gk := schema.FromAPIVersionAndKind(f["apiVersion"].GetStringValue(), f["kind"].GetStringValue()).GroupKind()
+		if !ns[gk] {
+			continue
+		}
+		md := f["metadata"].GetStructValue()
+		if md == nil {
+			md = &structpb.Struct{}
+			f["metadata"] = structpb.NewStructValue(md)
+		}
+		if md.Fields == nil {
+			md.Fields = map[string]*structpb.Value{}
+		}
+		if md.GetFields()["namespace"].GetStringValue() != "" {
+			continue
+		}
+		md.Fields["namespace"] = structpb.NewStringValue(namespace)
+	}
+}
+
+// CompositeConnectionDetailKeys returns the sorted keys of the connection
+// details of the desired composite resource in the supplied response. Use it
+// to check that a Function publishes the connection details it's expected to,
+// for example an endpoint and password.
+func CompositeConnectionDetailKeys(rsp *v1beta1.RunFunctionResponse) []string {
+	keys := make([]string, 0, len(rsp.GetDesired().GetComposite().GetConnectionDetails()))
+	for k := range rsp.GetDesired().GetComposite().GetConnectionDetails() {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// GetRequirementIDs returns the sorted IDs of the extra resources required by
+// the supplied RunFunctionResponse. Requirements are only carried by responses,
+// so a Function may use this to avoid re-requesting, or requesting conflicting,
+// extra resources under an ID that is already in use.
+func GetRequirementIDs(rsp *v1beta1.RunFunctionResponse) []string {
+	ids := make([]string, 0, len(rsp.GetRequirements().GetExtraResources()))
+	for id := range rsp.GetRequirements().GetExtraResources() {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// UnusedRequirements returns the sorted IDs of the extra resources required by
+// the supplied RunFunctionResponse that aren't among the supplied used IDs. It's
+// intended for use in tests, to catch a Function requiring extra resources it
+// never reads.
+func UnusedRequirements(rsp *v1beta1.RunFunctionResponse, used []string) []string {
+	u := make(map[string]bool, len(used))
+	for _, id := range used {
+		u[id] = true
+	}
+	unused := make([]string, 0)
+	for _, id := range GetRequirementIDs(rsp) {
+		if !u[id] {
+			unused = append(unused, id)
+		}
+	}
+	return unused
+}
+
+// A ResourceSelectorBuilder builds selectors for extra resources of a
+// particular kind. Use NewResourceSelector to create one.
+type ResourceSelectorBuilder struct {
+	gvk schema.GroupVersionKind
+}
+
+// NewResourceSelector returns a builder of selectors for extra resources of the
+// supplied kind. For example:
+//
+//	rsp.Requirements = &v1beta1.Requirements{
+//		ExtraResources: map[string]*v1beta1.ResourceSelector{
+//			"config": NewResourceSelector(gvk).ByName("cool-config"),
+//		},
+//	}
+func NewResourceSelector(gvk schema.GroupVersionKind) ResourceSelectorBuilder {
+	return ResourceSelectorBuilder{gvk: gvk}
+}
+
+// ByName returns a selector that matches the extra resource with the supplied
+// name.
+func (b ResourceSelectorBuilder) ByName(name string) *v1beta1.ResourceSelector {
+	av, k := b.gvk.ToAPIVersionAndKind()
+	return &v1beta1.ResourceSelector{
+		ApiVersion: av,
+		Kind:       k,
+		Match:      &v1beta1.ResourceSelector_MatchName{MatchName: name},
+	}
+}
+
+// ByLabels returns a selector that matches all extra resources with the
+// supplied labels.
+func (b ResourceSelectorBuilder) ByLabels(labels map[string]string) *v1beta1.ResourceSelector {
+	av, k := b.gvk.ToAPIVersionAndKind()
+	return &v1beta1.ResourceSelector{
+		ApiVersion: av,
+		Kind:       k,
+		Match:      &v1beta1.ResourceSelector_MatchLabels{MatchLabels: &v1beta1.MatchLabels{Labels: labels}},
+	}
+}
+
+// RequestExtraFromRef requires the extra resource of the supplied kind whose
+// name is at the supplied field path of the observed composite resource, e.g.
+// spec.networkRef.name. The requirement is added to the supplied response under
+// the supplied ID. It returns an error if the field path isn't set, or isn't a
+// non-empty string.
+func RequestExtraFromRef(rsp *v1beta1.RunFunctionResponse, req *v1beta1.RunFunctionRequest, id, path string, gvk schema.GroupVersionKind) error {
+	name, err := fieldpath.Pave(req.GetObserved().GetComposite().GetResource().AsMap()).GetString(path)
+	if fieldpath.IsNotFound(err) {
+		return errors.Errorf("observed composite resource field %q is not set", path)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "cannot get extra resource name from observed composite resource field %q", path)
+	}
+	if name == "" {
+		return errors.Errorf("observed composite resource field %q is empty", path)
+	}
+	if rsp.GetRequirements() == nil {
+		rsp.Requirements = &v1beta1.Requirements{}
+	}
+	if rsp.GetRequirements().GetExtraResources() == nil {
+		rsp.Requirements.ExtraResources = make(map[string]*v1beta1.ResourceSelector)
+	}
+	rsp.Requirements.ExtraResources[id] = NewResourceSelector(gvk).ByName(name)
+	return nil
+}
+
+// ValidateRequirements returns an error if any extra resource selector required
+// by the supplied RunFunctionResponse doesn't have a valid apiVersion and a
+// kind, or doesn't match by either name or labels. Crossplane can't fetch extra
+// resources for such a selector, and the error it returns doesn't say which
+// selector is at fault.
+func ValidateRequirements(rsp *v1beta1.RunFunctionResponse) error {
+	for _, id := range GetRequirementIDs(rsp) {
+		sel := rsp.GetRequirements().GetExtraResources()[id]
+		if sel.GetApiVersion() == "" {
+			return errors.Errorf("extra resource selector %q has no apiVersion", id)
+		}
+		if _, err := schema.ParseGroupVersion(sel.GetApiVersion()); err != nil {
+			return errors.Wrapf(err, "extra resource selector %q has invalid apiVersion", id)
+		}
+		if sel.GetKind() == "" {
+			return errors.Errorf("extra resource selector %q has no kind", id)
+		}
+		switch m := sel.GetMatch().(type) {
+		case *v1beta1.ResourceSelector_MatchName:
+			if m.MatchName == "" {
+				return errors.Errorf("extra resource selector %q matches an empty name", id)
+			}
+		case *v1beta1.ResourceSelector_MatchLabels:
+			if m.MatchLabels == nil {
+				return errors.Errorf("extra resource selector %q has no labels to match", id)
+			}
+		default:
+			return errors.Errorf("extra resource selector %q must match by either name or labels", id)
+		}
+	}
+	return nil
+}
+
+// DesiredHash returns a stable hash of the desired state of the supplied
+// RunFunctionResponse. The hash doesn't depend on map ordering, so two
+// responses with the same desired state have the same hash.
+func DesiredHash(rsp *v1beta1.RunFunctionResponse) (string, error) {
+	// protojson output isn't stable - it deliberately varies its whitespace.
+	// Round-tripping through encoding/json canonicalizes it by sorting object
+	// keys and removing insignificant whitespace.
+	j, err := protojson.Marshal(rsp.GetDesired())
+	if err != nil {
+		return "", errors.Wrap(err, "cannot marshal desired state to JSON")
+	}
+	var v any
+	if err := json.Unmarshal(j, &v); err != nil {
+		return "", errors.Wrap(err, "cannot unmarshal desired state JSON")
+	}
+	c, err := json.Marshal(v)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot marshal canonical desired state JSON")
+	}
+	h := sha256.Sum256(c)
+	return hex.EncodeToString(h[:]), nil
+}
+
+// Merge the supplied src response into the supplied dst response. Merge is
+// intended for Functions composed of reusable steps that each produce a partial
+// response.
+//
+//   - Desired composed resources are unioned. The src resource wins if both
+//     responses desire a composed resource with the same name.
+//   - The src desired composite resource, if any, replaces the dst one.
+//   - The src results are appended to the dst results.
+//   - Context and extra resource requirements are unioned. The src value wins if
+//     both responses have the same key.
+//   - The shorter of the two TTLs is used.
+func Merge(dst, src *v1beta1.RunFunctionResponse) {
+	if src.GetDesired() != nil {
+		if dst.GetDesired() == nil {
+			dst.Desired = &v1beta1.State{}
+		}
+		if src.GetDesired().GetComposite() != nil {
+			dst.Desired.Composite = src.GetDesired().GetComposite()
+		}
+		if len(src.GetDesired().GetResources()) > 0 && dst.GetDesired().GetResources() == nil {
+			dst.Desired.Resources = make(map[string]*v1beta1.Resource, len(src.GetDesired().GetResources()))
+		}
+		for name, r := range src.GetDesired().GetResources() {
+			dst.Desired.Resources[name] = r
+		}
+	}
+
+	dst.Results = append(dst.GetResults(), src.GetResults()...)
+
+	for k, v := range src.GetContext().GetFields() {
+		SetContextKey(dst, k, v)
+	}
+
+	if len(src.GetRequirements().GetExtraResources()) > 0 {
+		if dst.GetRequirements() == nil {
+			dst.Requirements = &v1beta1.Requirements{}
+		}
+		if dst.GetRequirements().GetExtraResources() == nil {
+			dst.Requirements.ExtraResources = make(map[string]*v1beta1.ResourceSelector, len(src.GetRequirements().GetExtraResources()))
+		}
+		for id, sel := range src.GetRequirements().GetExtraResources() {
+			dst.Requirements.ExtraResources[id] = sel
+		}
+	}
+
+	if src.GetMeta().GetTtl() != nil {
+		if dst.GetMeta() == nil {
+			dst.Meta = &v1beta1.ResponseMeta{Tag: src.GetMeta().GetTag()}
+		}
+		if dst.GetMeta().GetTtl() == nil || src.GetMeta().GetTtl().AsDuration() < dst.GetMeta().GetTtl().AsDuration() {
+			dst.Meta.Ttl = src.GetMeta().GetTtl()
+		}
+	}
+}
+
+// A CollisionStrategy determines how ResolveNameCollisions resolves desired
+// composed resources with the same name.
+type CollisionStrategy string
+
+// Collision strategies.
+const (
+	// CollisionError returns an error if any names collide.
+	CollisionError CollisionStrategy = "Error"
+
+	// CollisionFirstWins keeps the dst resource, dropping the src resource.
+	CollisionFirstWins CollisionStrategy = "FirstWins"
+
+	// CollisionSuffix renames the src resource by appending a numeric suffix,
+	// e.g. "bucket-2".
+	CollisionSuffix CollisionStrategy = "Suffix"
+)
+
+// Collisions reports how ResolveNameCollisions resolved collisions.
+type Collisions struct {
+	// Renamed maps the original name of each renamed src resource to its new
+	// name.
+	Renamed map[resource.Name]resource.Name
+
+	// Dropped are the names of the src resources that were dropped.
+	Dropped []resource.Name
+}
+
+// ResolveNameCollisions resolves collisions between the names of the desired
+// composed resources of the supplied src and dst responses, using the supplied
+// strategy. Only the src response is modified. Call it before Merge, which
+// would otherwise silently replace dst resources with src resources of the
+// same name. Renamed resources that are annotated with their composition
+// resource name have their annotation updated.
+func ResolveNameCollisions(dst, src *v1beta1.RunFunctionResponse, strategy CollisionStrategy) (Collisions, error) {
+	c := Collisions{Renamed: map[resource.Name]resource.Name{}, Dropped: []resource.Name{}}
+
+	collisions := make([]string, 0)
+	for name := range src.GetDesired().GetResources() {
+		if _, ok := dst.GetDesired().GetResources()[name]; ok {
+			collisions = append(collisions, name)
+		}
+	}
+	if len(collisions) == 0 {
+		return c, nil
+	}
+	sort.Strings(collisions)
+
+	switch strategy {
+	case CollisionError:
+		return c, errors.Errorf("desired composed resource names collide: %s", strings.Join(collisions, ", "))
+	case CollisionFirstWins:
+		for _, name := range collisions {
+			delete(src.Desired.Resources, name)
+			c.Dropped = append(c.Dropped, resource.Name(name))
+		}
+	case CollisionSuffix:
+		for _, name := range collisions {
+			r := src.Desired.Resources[name]
+			delete(src.Desired.Resources, name)
+			renamed := suffixed(name, dst, src)
+			setCompositionResourceName(r, renamed)
+			src.Desired.Resources[renamed] = r
+			c.Renamed[resource.Name(name)] = resource.Name(renamed)
+		}
+	default:
+		return c, errors.Errorf("unknown collision strategy %q", strategy)
+	}
+	return c, nil
+}
+
+// suffixed returns the supplied name with the lowest numeric suffix that isn't
+// used by either of the supplied responses' desired composed resources.
+func suffixed(name string, rsps ...*v1beta1.RunFunctionResponse) string {
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s-%d", name, i)
+		used := false
+		for _, rsp := range rsps {
+			if _, ok := rsp.GetDesired().GetResources()[candidate]; ok {
+				used = true
+			}
+		}
+		if !used {
+			return candidate
+		}
+	}
+}
+
+// setCompositionResourceName updates the composition resource name annotation
+// of the supplied resource, if it has one.
+func setCompositionResourceName(r *v1beta1.Resource, name string) {
+	a := r.GetResource().GetFields()["metadata"].GetStructValue().GetFields()["annotations"].GetStructValue()
+	if _, ok := a.GetFields()[resource.AnnotationKeyCompositionResourceName]; ok {
+		a.Fields[resource.AnnotationKeyCompositionResourceName] = structpb.NewStringValue(name)
+	}
+}
+
+// CheckResourceNames returns an error if any desired composed resource in the
+// supplied RunFunctionResponse is annotated with a composition resource name
+// that doesn't match its key in the desired resources map. Crossplane uses the
+// annotation to associate composed resources with desired resources, so a
+// mismatch causes resources to be repeatedly created and deleted.
+func CheckResourceNames(rsp *v1beta1.RunFunctionResponse) error {
+	names := make([]string, 0, len(rsp.GetDesired().GetResources()))
+	for name := range rsp.GetDesired().GetResources() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		md := rsp.GetDesired().GetResources()[name].GetResource().GetFields()["metadata"].GetStructValue()
+		v, ok := md.GetFields()["annotations"].GetStructValue().GetFields()[resource.AnnotationKeyCompositionResourceName]
+		if !ok {
+			continue
+		}
+		if an := v.GetStringValue(); an != name {
+			return errors.Errorf("desired composed resource %q has %s annotation %q", name, resource.AnnotationKeyCompositionResourceName, an)
+		}
+	}
+	return nil
+}
+
+// CheckTag returns an error if the tag of the supplied response doesn't match
+// that of the supplied request. Crossplane uses the tag to cache responses, so
+// a response built without To must be sure to copy the request's tag.
+func CheckTag(rsp *v1beta1.RunFunctionResponse, req *v1beta1.RunFunctionRequest) error {
+	if got, want := rsp.GetMeta().GetTag(), req.GetMeta().GetTag(); got != want {
+		return errors.Errorf("response tag %q doesn't match request tag %q", got, want)
+	}
+	return nil
+}
+
+// CheckDesiredGVKs returns an error if any desired composed resource in the
+// supplied RunFunctionResponse doesn't have a valid apiVersion and a kind.
+// Crossplane can't compose a resource without them, and the error it returns
+// doesn't say which resource is at fault.
+func CheckDesiredGVKs(rsp *v1beta1.RunFunctionResponse) error {
+	names := make([]string, 0, len(rsp.GetDesired().GetResources()))
+	for name := range rsp.GetDesired().GetResources() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := rsp.GetDesired().GetResources()[name].GetResource().GetFields()
+		av := f["apiVersion"].GetStringValue()
+		if av == "" {
+			return errors.Errorf("desired composed resource %q has no apiVersion", name)
+		}
+		if _, err := schema.ParseGroupVersion(av); err != nil {
+			return errors.Wrapf(err, "desired composed resource %q has invalid apiVersion", name)
+		}
+		if f["kind"].GetStringValue() == "" {
+			return errors.Errorf("desired composed resource %q has no kind", name)
+		}
+	}
+	return nil
+}
+
+// CarryForwardComposed copies the supplied observed composed resources from the
+// supplied request into the desired composed resources of the supplied
+// response. Fields set by the API server or the resources' controllers are
+// removed - see resource.Sanitize. Use it to preserve composed resources a
+// Function doesn't manage, without touching any other desired state. It returns
+// an error, and changes nothing, if any of the named resources isn't observed.
+func CarryForwardComposed(rsp *v1beta1.RunFunctionResponse, req *v1beta1.RunFunctionRequest, names ...resource.Name) error {
+	dcds := make(map[resource.Name]*resource.DesiredComposed, len(names))
+	for _, name := range names {
+		r, ok := req.GetObserved().GetResources()[string(name)]
+		if !ok {
+			return errors.Errorf("composed resource %q is not observed", name)
+		}
+		dcd := resource.NewDesiredComposed()
+		if err := resource.AsObject(r.GetResource(), dcd.Resource); err != nil {
+			return errors.Wrapf(err, "cannot get observed composed resource %q", name)
+		}
+		resource.Sanitize(dcd)
+		dcds[name] = dcd
+	}
+	return SetDesiredComposedResources(rsp, dcds)
+}
+
+// SkipIfDeleting returns true if the observed composite resource in the
+// supplied request is being deleted, and adds a normal result to the supplied
+// response explaining that the Function was skipped. A Function should return
+// the response as is when it returns true, rather than adding desired composed
+// resources that would otherwise prevent the composite resource from being
+// deleted.
+func SkipIfDeleting(rsp *v1beta1.RunFunctionResponse, req *v1beta1.RunFunctionRequest) bool {
+	oxr := &resource.Composite{Resource: composite.New()}
+	if err := resource.AsObject(req.GetObserved().GetComposite().GetResource(), oxr.Resource); err != nil {
+		return false
+	}
+	if !resource.IsBeingDeleted(oxr) {
+		return false
+	}
+	Normal(rsp, "composite resource is being deleted - not composing resources")
+	return true
+}
+
+// GateOnReady adds the supplied dependent desired composed resource to the
+// supplied response, but only once the supplied dependency has been observed to
+// be ready. Until then it adds a normal result explaining what the dependent
+// resource is waiting for. Use it to avoid creating a composed resource before
+// a resource it depends on is ready.
+//
+// The dependent resource is always added if it has already been observed, so
+// that it isn't deleted if its dependency later becomes unready.
+func GateOnReady(rsp *v1beta1.RunFunctionResponse, req *v1beta1.RunFunctionRequest, dependency resource.Name, dependent *resource.DesiredComposed, name resource.Name) error {
+	_, exists := req.GetObserved().GetResources()[string(name)]
+	if !exists {
+		ready, err := observedReady(req, dependency)
+		if err != nil {
+			return err
+		}
+		if !ready {
+			Normalf(rsp, "waiting for composed resource %q to be ready before creating %q", dependency, name)
+			return nil
+		}
+	}
+	return SetDesiredComposedResources(rsp, map[resource.Name]*resource.DesiredComposed{name: dependent})
+}
+
+// observedReady returns true if the named composed resource has been observed
+// and has a ready condition with status true.
+func observedReady(req *v1beta1.RunFunctionRequest, name resource.Name) (bool, error) {
+	r, ok := req.GetObserved().GetResources()[string(name)]
+	if !ok {
+		return false, nil
+	}
+	cd := composed.New()
+	if err := resource.AsObject(r.GetResource(), cd); err != nil {
+		return false, errors.Wrapf(err, "cannot get observed composed resource %q", name)
+	}
+	return cd.GetCondition(xpv1.TypeReady).Status == corev1.ConditionTrue, nil
+}
+
+// DesiredComposedCount returns the number of desired composed resources in the
+// supplied RunFunctionResponse.
+func DesiredComposedCount(rsp *v1beta1.RunFunctionResponse) int {
+	return len(rsp.GetDesired().GetResources())
+}
+
+// TruncateDesiredComposed removes desired composed resources from the supplied
+// RunFunctionResponse until at most limit remain. Resources are kept in order of
+// their names, so the same resources are kept each time the Function runs. It
+// returns how many desired composed resources were removed. Note that removing
+// a desired composed resource that already exists will cause it to be deleted.
+// A negative limit is treated as zero.
+func TruncateDesiredComposed(rsp *v1beta1.RunFunctionResponse, limit int) int {
+	limit = max(limit, 0)
+	if DesiredComposedCount(rsp) <= limit {
+		return 0
+	}
+	names := make([]string, 0, len(rsp.GetDesired().GetResources()))
+	for name := range rsp.GetDesired().GetResources() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names[limit:] {
+		delete(rsp.Desired.Resources, name)
+	}
+	return len(names) - limit
+}
+
+// ThrottleDesiredComposed limits how many new composed resources the supplied
+// RunFunctionResponse creates at once. Of the supplied names, desired composed
+// resources that have already been observed are always kept. Those that haven't
+// are kept in the supplied order until batchSize have been kept, and the rest
+// are removed from the response so they'll be created by a later run of the
+// Function. Desired composed resources that aren't named aren't throttled. It
+// adds a normal result reporting progress, and returns how many desired
+// composed resources were deferred. It returns an error if batchSize is less
+// than one.
+func ThrottleDesiredComposed(rsp *v1beta1.RunFunctionResponse, req *v1beta1.RunFunctionRequest, batchSize int, order []resource.Name) (int, error) {
+	if batchSize < 1 {
+		return 0, errors.Errorf("batch size must be at least 1, got %d", batchSize)
+	}
+	created, pending := 0, 0
+	for _, name := range order {
+		if _, ok := rsp.GetDesired().GetResources()[string(name)]; !ok {
+			continue
+		}
+		if _, ok := req.GetObserved().GetResources()[string(name)]; ok {
+			created++
+			continue
+		}
+		pending++
+		if pending > batchSize {
+			delete(rsp.Desired.Resources, string(name))
+		}
+	}
+	deferred := max(pending-batchSize, 0)
+	if deferred > 0 {
+		Normalf(rsp, "created %d of %d composed resources, creating %d more - deferring %d to a later run", created, created+pending, pending-deferred, deferred)
+	}
+	return deferred, nil
+}
+
+// PendingDeletions returns the sorted names of the composed resources that
+// were observed in the supplied request, but aren't desired by the supplied
+// response. Crossplane will delete these resources, unless a subsequent
+// Function in the pipeline desires them.
+func PendingDeletions(rsp *v1beta1.RunFunctionResponse, req *v1beta1.RunFunctionRequest) []resource.Name {
+	names := make([]resource.Name, 0)
+	for name := range req.GetObserved().GetResources() {
+		if _, ok := rsp.GetDesired().GetResources()[name]; !ok {
+			names = append(names, resource.Name(name))
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
 // Fatal adds a fatal result to the supplied RunFunctionResponse.
 func Fatal(rsp *v1beta1.RunFunctionResponse, err error) {
 	if rsp.GetResults() == nil {
@@ -118,6 +992,23 @@ func Warning(rsp *v1beta1.RunFunctionResponse, err error) {
 	})
 }
 
+// WarningWithLink adds a warning result to the supplied RunFunctionResponse
+// that links to the supplied documentation URL, for example to explain how to
+// fix a known issue. Results don't support links, so the URL is appended to
+// the message, like "boom (see: https://example.org/docs)". It returns an error,
+// and adds no result, if the URL isn't an absolute HTTP or HTTPS URL.
+func WarningWithLink(rsp *v1beta1.RunFunctionResponse, err error, docURL string) error {
+	u, perr := url.Parse(docURL)
+	if perr != nil {
+		return errors.Wrapf(perr, "invalid documentation URL %q", docURL)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.Errorf("invalid documentation URL %q - must be an absolute HTTP or HTTPS URL", docURL)
+	}
+	Warning(rsp, errors.Errorf("%s (see: %s)", err, u))
+	return nil
+}
+
 // Normal adds a normal result to the supplied RunFunctionResponse.
 func Normal(rsp *v1beta1.RunFunctionResponse, message string) {
 	if rsp.GetResults() == nil {
@@ -129,7 +1020,121 @@ func Normal(rsp *v1beta1.RunFunctionResponse, message string) {
 	})
 }
 
+// NormalWithData adds a normal result with the supplied structured data to the
+// supplied RunFunctionResponse. Results can't yet carry structured data, so the
+// data is recorded in the response's context under the context.KeyResultData
+// key, along with the result's message.
+func NormalWithData(rsp *v1beta1.RunFunctionResponse, message string, data map[string]any) error {
+	d, err := structpb.NewStruct(data)
+	if err != nil {
+		return errors.Wrap(err, "cannot convert result data to a struct")
+	}
+	setResultData(rsp, message, d)
+	Normal(rsp, message)
+	return nil
+}
+
+// WarningForField adds a warning result about the supplied field path to the
+// supplied RunFunctionResponse, for example "spec.parameters.size: too large".
+// Like Kubernetes field errors, the message is prefixed with the field path.
+// The field path is also recorded as structured data under the
+// context.KeyResultData key, so tools can highlight the field without parsing
+// the message.
+func WarningForField(rsp *v1beta1.RunFunctionResponse, fieldPath string, err error) {
+	message := fmt.Sprintf("%s: %s", fieldPath, err)
+	setResultData(rsp, message, &structpb.Struct{Fields: map[string]*structpb.Value{
+		"fieldPath": structpb.NewStringValue(fieldPath),
+	}})
+	Warning(rsp, errors.New(message))
+}
+
+// setResultData records the supplied structured data for the result with the
+// supplied message under the context.KeyResultData key.
+func setResultData(rsp *v1beta1.RunFunctionResponse, message string, data *structpb.Struct) {
+	entries := rsp.GetContext().GetFields()[fncontext.KeyResultData].GetListValue().GetValues()
+	entries = append(entries, structpb.NewStructValue(&structpb.Struct{Fields: map[string]*structpb.Value{
+		"message": structpb.NewStringValue(message),
+		"data":    structpb.NewStructValue(data),
+	}}))
+	SetContextKey(rsp, fncontext.KeyResultData, structpb.NewListValue(&structpb.ListValue{Values: entries}))
+}
+
+// SetProgress records the progress of a multi-step operation, such as one that
+// spans several reconciles, in the context of the supplied response, and adds
+// a normal result like "step 2/5: creating database". Later Functions in the
+// pipeline can read the progress from the context key fncontext.KeyProgress.
+//
+// Context only lasts for a single run of the pipeline. A Function that needs
+// to resume from its last step on the next reconcile should also record its
+// progress in the desired composite resource's status.
+func SetProgress(rsp *v1beta1.RunFunctionResponse, step, total int, message string) {
+	SetContextKey(rsp, fncontext.KeyProgress, structpb.NewStructValue(&structpb.Struct{Fields: map[string]*structpb.Value{
+		"step":    structpb.NewNumberValue(float64(step)),
+		"total":   structpb.NewNumberValue(float64(total)),
+		"message": structpb.NewStringValue(message),
+	}}))
+	Normalf(rsp, "step %d/%d: %s", step, total, message)
+}
+
 // Normalf adds a normal result to the supplied RunFunctionResponse.
 func Normalf(rsp *v1beta1.RunFunctionResponse, format string, a ...any) {
 	Normal(rsp, fmt.Sprintf(format, a...))
 }
+
+// Summarize adds a normal result to the supplied RunFunctionResponse that
+// counts its existing warning and fatal results, e.g. "validated input: 3
+// warnings, 1 error". The supplied message prefixes the counts, unless it's
+// empty. Existing results are unchanged.
+func Summarize(rsp *v1beta1.RunFunctionResponse, message string) {
+	warnings, fatals := 0, 0
+	for _, r := range rsp.GetResults() {
+		switch r.GetSeverity() {
+		case v1beta1.Severity_SEVERITY_WARNING:
+			warnings++
+		case v1beta1.Severity_SEVERITY_FATAL:
+			fatals++
+		}
+	}
+	summary := plural(warnings, "warning") + ", " + plural(fatals, "error")
+	if message != "" {
+		summary = message + ": " + summary
+	}
+	Normal(rsp, summary)
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// ResultsError returns an error that wraps the messages of all fatal results
+// in the supplied RunFunctionResponse. It returns nil if the response has no
+// fatal results.
+func ResultsError(rsp *v1beta1.RunFunctionResponse) error {
+	var errs []error
+	for _, r := range rsp.GetResults() {
+		if r.GetSeverity() != v1beta1.Severity_SEVERITY_FATAL {
+			continue
+		}
+		errs = append(errs, errors.New(r.GetMessage()))
+	}
+	return errors.Join(errs...)
+}
+
+// FromFieldErrors adds a result to the supplied RunFunctionResponse for each of
+// the supplied field errors, for example those returned by Kubernetes API
+// validation. Each result's message includes the path of the invalid field.
+// Required and invalid field errors produce fatal results, while all other
+// field errors produce warning results.
+func FromFieldErrors(rsp *v1beta1.RunFunctionResponse, errs field.ErrorList) {
+	for _, err := range errs {
+		switch err.Type {
+		case field.ErrorTypeRequired, field.ErrorTypeInvalid:
+			Fatal(rsp, err)
+		default:
+			Warning(rsp, err)
+		}
+	}
+}
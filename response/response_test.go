@@ -0,0 +1,1859 @@
+/*
+Copyright 2023 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package response
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	fncontext "github.com/crossplane/function-sdk-go/context"
+	"github.com/crossplane/function-sdk-go/errors"
+	"github.com/crossplane/function-sdk-go/proto/v1beta1"
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/resource/composed"
+	"github.com/crossplane/function-sdk-go/resource/composite"
+)
+
+func TestResultsError(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		rsp    *v1beta1.RunFunctionResponse
+		want   error
+	}{
+		"NoResults": {
+			reason: "A response with no results should not produce an error.",
+			rsp:    &v1beta1.RunFunctionResponse{},
+			want:   nil,
+		},
+		"NoFatalResults": {
+			reason: "A response with only non-fatal results should not produce an error.",
+			rsp: &v1beta1.RunFunctionResponse{
+				Results: []*v1beta1.Result{
+					{Severity: v1beta1.Severity_SEVERITY_NORMAL, Message: "hi"},
+					{Severity: v1beta1.Severity_SEVERITY_WARNING, Message: "careful"},
+				},
+			},
+			want: nil,
+		},
+		"FatalResults": {
+			reason: "A response with fatal results should produce an error wrapping each of them.",
+			rsp: &v1beta1.RunFunctionResponse{
+				Results: []*v1beta1.Result{
+					{Severity: v1beta1.Severity_SEVERITY_FATAL, Message: "boom"},
+					{Severity: v1beta1.Severity_SEVERITY_WARNING, Message: "careful"},
+					{Severity: v1beta1.Severity_SEVERITY_FATAL, Message: "bang"},
+				},
+			},
+			want: errors.Join(errors.New("boom"), errors.New("bang")),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := ResultsError(tc.rsp)
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nResultsError(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	cases := map[string]struct {
+		reason  string
+		results []*v1beta1.Result
+		message string
+		want    string
+	}{
+		"NoResults": {
+			reason: "A response with no results should summarize zero warnings and errors.",
+			want:   "0 warnings, 0 errors",
+		},
+		"Results": {
+			reason: "A response's warning and fatal results should be counted, and prefixed with the message.",
+			results: []*v1beta1.Result{
+				{Severity: v1beta1.Severity_SEVERITY_NORMAL, Message: "hi"},
+				{Severity: v1beta1.Severity_SEVERITY_WARNING, Message: "careful"},
+				{Severity: v1beta1.Severity_SEVERITY_WARNING, Message: "very careful"},
+				{Severity: v1beta1.Severity_SEVERITY_FATAL, Message: "boom"},
+			},
+			message: "validated input",
+			want:    "validated input: 2 warnings, 1 error",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := &v1beta1.RunFunctionResponse{Results: tc.results}
+			Summarize(rsp, tc.message)
+
+			want := &v1beta1.RunFunctionResponse{Results: append(tc.results, &v1beta1.Result{
+				Severity: v1beta1.Severity_SEVERITY_NORMAL,
+				Message:  tc.want,
+			})}
+			if diff := cmp.Diff(want, rsp, protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\nSummarize(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestPassthrough(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		req    *v1beta1.RunFunctionRequest
+		ttl    time.Duration
+		want   *v1beta1.RunFunctionResponse
+	}{
+		"EmptyRequest": {
+			reason: "We should return a response with only the supplied TTL if the request is empty.",
+			req:    &v1beta1.RunFunctionRequest{},
+			ttl:    DefaultTTL,
+			want: &v1beta1.RunFunctionResponse{
+				Meta: &v1beta1.ResponseMeta{Ttl: durationpb.New(DefaultTTL)},
+			},
+		},
+		"PassThrough": {
+			reason: "We should pass through the tag, desired state, and context unchanged, without adding results.",
+			req: &v1beta1.RunFunctionRequest{
+				Meta: &v1beta1.RequestMeta{Tag: "cool-tag"},
+				Observed: &v1beta1.State{
+					Composite: &v1beta1.Resource{Resource: resource.MustStructJSON(`{"spec":{"widgets":9001}}`)},
+				},
+				Desired: &v1beta1.State{
+					Composite: &v1beta1.Resource{Resource: resource.MustStructJSON(`{"status":{"widgets":9001}}`)},
+					Resources: map[string]*v1beta1.Resource{
+						"a": {Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"Cool"}`)},
+					},
+				},
+				Context: resource.MustStructJSON(`{"cool":true}`),
+			},
+			ttl: time.Minute,
+			want: &v1beta1.RunFunctionResponse{
+				Meta: &v1beta1.ResponseMeta{Tag: "cool-tag", Ttl: durationpb.New(time.Minute)},
+				Desired: &v1beta1.State{
+					Composite: &v1beta1.Resource{Resource: resource.MustStructJSON(`{"status":{"widgets":9001}}`)},
+					Resources: map[string]*v1beta1.Resource{
+						"a": {Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"Cool"}`)},
+					},
+				},
+				Context: resource.MustStructJSON(`{"cool":true}`),
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := Passthrough(tc.req, tc.ttl)
+			if diff := cmp.Diff(tc.want, got, protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\nPassthrough(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRequeueAfter(t *testing.T) {
+	type args struct {
+		rsp *v1beta1.RunFunctionResponse
+		d   time.Duration
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   *v1beta1.RunFunctionResponse
+	}{
+		"NoMeta": {
+			reason: "We should add response metadata with the supplied TTL if the response has none.",
+			args: args{
+				rsp: &v1beta1.RunFunctionResponse{},
+				d:   10 * time.Second,
+			},
+			want: &v1beta1.RunFunctionResponse{
+				Meta: &v1beta1.ResponseMeta{Ttl: durationpb.New(10 * time.Second)},
+			},
+		},
+		"ExistingMeta": {
+			reason: "We should replace the TTL of an existing response, preserving the rest of its metadata.",
+			args: args{
+				rsp: &v1beta1.RunFunctionResponse{
+					Meta: &v1beta1.ResponseMeta{Tag: "cool-tag", Ttl: durationpb.New(DefaultTTL)},
+				},
+				d: 10 * time.Second,
+			},
+			want: &v1beta1.RunFunctionResponse{
+				Meta: &v1beta1.ResponseMeta{Tag: "cool-tag", Ttl: durationpb.New(10 * time.Second)},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			RequeueAfter(tc.args.rsp, tc.args.d)
+			if diff := cmp.Diff(tc.want, tc.args.rsp, protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\nRequeueAfter(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestTTLForResults(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		rsp    *v1beta1.RunFunctionResponse
+		def    time.Duration
+		want   time.Duration
+	}{
+		"NoResults": {
+			reason: "A response with no results should use the default TTL.",
+			rsp:    &v1beta1.RunFunctionResponse{},
+			def:    DefaultTTL,
+			want:   DefaultTTL,
+		},
+		"NormalResults": {
+			reason: "A response with only normal results should use the default TTL.",
+			rsp: &v1beta1.RunFunctionResponse{Results: []*v1beta1.Result{
+				{Severity: v1beta1.Severity_SEVERITY_NORMAL, Message: "hi"},
+			}},
+			def:  DefaultTTL,
+			want: DefaultTTL,
+		},
+		"WarningResults": {
+			reason: "A response with warning results should use the error TTL.",
+			rsp: &v1beta1.RunFunctionResponse{Results: []*v1beta1.Result{
+				{Severity: v1beta1.Severity_SEVERITY_NORMAL, Message: "hi"},
+				{Severity: v1beta1.Severity_SEVERITY_WARNING, Message: "careful"},
+			}},
+			def:  DefaultTTL,
+			want: ErrorTTL,
+		},
+		"ShortDefault": {
+			reason: "A response with fatal results should use the default TTL if it's shorter than the error TTL.",
+			rsp: &v1beta1.RunFunctionResponse{Results: []*v1beta1.Result{
+				{Severity: v1beta1.Severity_SEVERITY_FATAL, Message: "boom"},
+			}},
+			def:  time.Second,
+			want: time.Second,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := TTLForResults(tc.rsp, tc.def)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nTTLForResults(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestPreserveCompositeStatus(t *testing.T) {
+	req := &v1beta1.RunFunctionRequest{
+		Observed: &v1beta1.State{Composite: &v1beta1.Resource{
+			Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"XR","status":{"network":{"id":"n-1","cidr":"10.0.0.0/8"},"phase":"Old"}}`),
+		}},
+	}
+	rsp := &v1beta1.RunFunctionResponse{Desired: &v1beta1.State{Composite: &v1beta1.Resource{
+		Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"XR","status":{"network":{"cidr":"10.1.0.0/16"},"phase":"New"}}`),
+	}}}
+
+	if err := PreserveCompositeStatus(rsp, req); err != nil {
+		t.Fatalf("PreserveCompositeStatus(...): unexpected error: %v", err)
+	}
+
+	want := &v1beta1.RunFunctionResponse{Desired: &v1beta1.State{Composite: &v1beta1.Resource{
+		Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"XR","status":{"network":{"id":"n-1","cidr":"10.1.0.0/16"},"phase":"New"}}`),
+	}}}
+	if diff := cmp.Diff(want, rsp, protocmp.Transform()); diff != "" {
+		t.Errorf("PreserveCompositeStatus(...): -want, +got:\n%s", diff)
+	}
+}
+
+func TestPreserveCompositeStatusFields(t *testing.T) {
+	req := &v1beta1.RunFunctionRequest{
+		Observed: &v1beta1.State{Composite: &v1beta1.Resource{
+			Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"XR","status":{"network":{"id":"n-1"},"phase":"Old","other":"value"}}`),
+		}},
+	}
+
+	type want struct {
+		rsp *v1beta1.RunFunctionResponse
+		err bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		paths  []string
+		want   want
+	}{
+		"InvalidPath": {
+			reason: "We should return an error if a field path is invalid.",
+			paths:  []string{"status["},
+			want: want{
+				rsp: &v1beta1.RunFunctionResponse{Desired: &v1beta1.State{Composite: &v1beta1.Resource{
+					Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"XR","status":{"phase":"New"}}`),
+				}}},
+				err: true,
+			},
+		},
+		"Preserve": {
+			reason: "We should copy only the supplied observed status fields the desired composite doesn't set.",
+			paths:  []string{"status.network.id", "status.phase", "status.missing"},
+			want: want{
+				rsp: &v1beta1.RunFunctionResponse{Desired: &v1beta1.State{Composite: &v1beta1.Resource{
+					Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"XR","status":{"network":{"id":"n-1"},"phase":"New"}}`),
+				}}},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := &v1beta1.RunFunctionResponse{Desired: &v1beta1.State{Composite: &v1beta1.Resource{
+				Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"XR","status":{"phase":"New"}}`),
+			}}}
+			err := PreserveCompositeStatusFields(rsp, req, tc.paths...)
+
+			if diff := cmp.Diff(tc.want.rsp, rsp, protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\nPreserveCompositeStatusFields(...): -want rsp, +got rsp:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, err != nil); diff != "" {
+				t.Errorf("\n%s\nPreserveCompositeStatusFields(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestCompositeChanged(t *testing.T) {
+	observed := &v1beta1.RunFunctionRequest{
+		Observed: &v1beta1.State{Composite: &v1beta1.Resource{
+			Resource: resource.MustStructJSON(`{"metadata":{"name":"cool"},"spec":{"size":"large"},"status":{"ready":true,"network":{"cidr":"10.0.0.0/8","zone":"a"}}}`),
+		}},
+	}
+
+	cases := map[string]struct {
+		reason string
+		req    *v1beta1.RunFunctionRequest
+		rsp    *v1beta1.RunFunctionResponse
+		want   bool
+	}{
+		"NoObservedComposite": {
+			reason: "We should return false if there is no observed composite resource.",
+			req:    &v1beta1.RunFunctionRequest{},
+			rsp: &v1beta1.RunFunctionResponse{Desired: &v1beta1.State{Composite: &v1beta1.Resource{
+				Resource: resource.MustStructJSON(`{"status":{"ready":false}}`),
+			}}},
+			want: false,
+		},
+		"NoDesiredComposite": {
+			reason: "We should return false if there is no desired composite resource.",
+			req:    observed,
+			rsp:    &v1beta1.RunFunctionResponse{},
+			want:   false,
+		},
+		"SubsetUnchanged": {
+			reason: "We should return false if the desired status fields match, ignoring omitted fields, spec, and metadata.",
+			req:    observed,
+			rsp: &v1beta1.RunFunctionResponse{Desired: &v1beta1.State{Composite: &v1beta1.Resource{
+				Resource: resource.MustStructJSON(`{"metadata":{"labels":{"new":"label"}},"spec":{"size":"small"},"status":{"network":{"zone":"a"}}}`),
+			}}},
+			want: false,
+		},
+		"NestedFieldChanged": {
+			reason: "We should return true if a nested desired status field differs.",
+			req:    observed,
+			rsp: &v1beta1.RunFunctionResponse{Desired: &v1beta1.State{Composite: &v1beta1.Resource{
+				Resource: resource.MustStructJSON(`{"status":{"network":{"zone":"b"}}}`),
+			}}},
+			want: true,
+		},
+		"FieldAdded": {
+			reason: "We should return true if the desired status sets a field the observed status doesn't have.",
+			req:    observed,
+			rsp: &v1beta1.RunFunctionResponse{Desired: &v1beta1.State{Composite: &v1beta1.Resource{
+				Resource: resource.MustStructJSON(`{"status":{"replicas":3}}`),
+			}}},
+			want: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := CompositeChanged(tc.rsp, tc.req)
+			if err != nil {
+				t.Fatalf("\n%s\nCompositeChanged(...): unexpected error: %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nCompositeChanged(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestSetNamespaceOnDesiredComposed(t *testing.T) {
+	rsp := &v1beta1.RunFunctionResponse{
+		Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{
+			"cm":      {Resource: resource.MustStructJSON(`{"apiVersion":"v1","kind":"ConfigMap"}`)},
+			"placed":  {Resource: resource.MustStructJSON(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"cool","namespace":"elsewhere"}}`)},
+			"role":    {Resource: resource.MustStructJSON(`{"apiVersion":"rbac.authorization.k8s.io/v1","kind":"ClusterRole"}`)},
+			"managed": {Resource: resource.MustStructJSON(`{"apiVersion":"s3.aws.upbound.io/v1beta1","kind":"Bucket"}`)},
+		}},
+	}
+
+	want := &v1beta1.RunFunctionResponse{
+		Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{
+			"cm":      {Resource: resource.MustStructJSON(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"namespace":"cool-ns"}}`)},
+			"placed":  {Resource: resource.MustStructJSON(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"cool","namespace":"elsewhere"}}`)},
+			"role":    {Resource: resource.MustStructJSON(`{"apiVersion":"rbac.authorization.k8s.io/v1","kind":"ClusterRole"}`)},
+			"managed": {Resource: resource.MustStructJSON(`{"apiVersion":"s3.aws.upbound.io/v1beta1","kind":"Bucket"}`)},
+		}},
+	}
+
+	// Only the supplied kinds should be namespaced. Others, like the ClusterRole
+	// and the managed resource, should be left as is.
+	SetNamespaceOnDesiredComposed(rsp, "cool-ns", schema.GroupKind{Kind: "ConfigMap"})
+	if diff := cmp.Diff(want, rsp, protocmp.Transform()); diff != "" {
+		t.Errorf("SetNamespaceOnDesiredComposed(...): -want, +got:\n%s", diff)
+	}
+}
+
+func TestCompositeConnectionDetailKeys(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		rsp    *v1beta1.RunFunctionResponse
+		want   []string
+	}{
+		"NoDesiredComposite": {
+			reason: "A response with no desired composite should return no keys.",
+			rsp:    &v1beta1.RunFunctionResponse{},
+			want:   []string{},
+		},
+		"ConnectionDetails": {
+			reason: "A response with desired composite connection details should return their sorted keys.",
+			rsp: &v1beta1.RunFunctionResponse{Desired: &v1beta1.State{Composite: &v1beta1.Resource{
+				ConnectionDetails: map[string][]byte{"password": []byte("secret"), "endpoint": []byte("db.example.org")},
+			}}},
+			want: []string{"endpoint", "password"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := CompositeConnectionDetailKeys(tc.rsp)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nCompositeConnectionDetailKeys(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestGetRequirementIDs(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		rsp    *v1beta1.RunFunctionResponse
+		want   []string
+	}{
+		"NoRequirements": {
+			reason: "A response with no requirements should return no IDs.",
+			rsp:    &v1beta1.RunFunctionResponse{},
+			want:   []string{},
+		},
+		"Requirements": {
+			reason: "A response with requirements should return their sorted IDs.",
+			rsp: &v1beta1.RunFunctionResponse{
+				Requirements: &v1beta1.Requirements{
+					ExtraResources: map[string]*v1beta1.ResourceSelector{
+						"b": {ApiVersion: "example.org/v1", Kind: "Cool"},
+						"a": {ApiVersion: "example.org/v1", Kind: "Cool"},
+					},
+				},
+			},
+			want: []string{"a", "b"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := GetRequirementIDs(tc.rsp)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nGetRequirementIDs(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestValidateRequirements(t *testing.T) {
+	withSelector := func(sel *v1beta1.ResourceSelector) *v1beta1.RunFunctionResponse {
+		return &v1beta1.RunFunctionResponse{
+			Requirements: &v1beta1.Requirements{
+				ExtraResources: map[string]*v1beta1.ResourceSelector{"cool": sel},
+			},
+		}
+	}
+
+	cases := map[string]struct {
+		reason string
+		rsp    *v1beta1.RunFunctionResponse
+		want   error
+	}{
+		"NoRequirements": {
+			reason: "A response with no requirements should be valid.",
+			rsp:    &v1beta1.RunFunctionResponse{},
+		},
+		"Valid": {
+			reason: "A response whose selectors have a kind and match by name or labels should be valid.",
+			rsp: &v1beta1.RunFunctionResponse{
+				Requirements: &v1beta1.Requirements{
+					ExtraResources: map[string]*v1beta1.ResourceSelector{
+						"name":   {ApiVersion: "example.org/v1", Kind: "Cool", Match: &v1beta1.ResourceSelector_MatchName{MatchName: "cool"}},
+						"labels": {ApiVersion: "v1", Kind: "ConfigMap", Match: &v1beta1.ResourceSelector_MatchLabels{MatchLabels: &v1beta1.MatchLabels{Labels: map[string]string{"a": "b"}}}},
+					},
+				},
+			},
+		},
+		"NoAPIVersion": {
+			reason: "A selector without an apiVersion should be invalid.",
+			rsp:    withSelector(&v1beta1.ResourceSelector{Kind: "Cool", Match: &v1beta1.ResourceSelector_MatchName{MatchName: "cool"}}),
+			want:   errors.New(`extra resource selector "cool" has no apiVersion`),
+		},
+		"NoKind": {
+			reason: "A selector without a kind should be invalid.",
+			rsp:    withSelector(&v1beta1.ResourceSelector{ApiVersion: "example.org/v1", Match: &v1beta1.ResourceSelector_MatchName{MatchName: "cool"}}),
+			want:   errors.New(`extra resource selector "cool" has no kind`),
+		},
+		"NoMatch": {
+			reason: "A selector that matches by neither name nor labels should be invalid.",
+			rsp:    withSelector(&v1beta1.ResourceSelector{ApiVersion: "example.org/v1", Kind: "Cool"}),
+			want:   errors.New(`extra resource selector "cool" must match by either name or labels`),
+		},
+		"EmptyName": {
+			reason: "A selector that matches an empty name should be invalid.",
+			rsp:    withSelector(&v1beta1.ResourceSelector{ApiVersion: "example.org/v1", Kind: "Cool", Match: &v1beta1.ResourceSelector_MatchName{}}),
+			want:   errors.New(`extra resource selector "cool" matches an empty name`),
+		},
+		"NilLabels": {
+			reason: "A selector that matches nil labels should be invalid.",
+			rsp:    withSelector(&v1beta1.ResourceSelector{ApiVersion: "example.org/v1", Kind: "Cool", Match: &v1beta1.ResourceSelector_MatchLabels{}}),
+			want:   errors.New(`extra resource selector "cool" has no labels to match`),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateRequirements(tc.rsp)
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nValidateRequirements(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestUnusedRequirements(t *testing.T) {
+	rsp := &v1beta1.RunFunctionResponse{
+		Requirements: &v1beta1.Requirements{
+			ExtraResources: map[string]*v1beta1.ResourceSelector{
+				"c": {ApiVersion: "example.org/v1", Kind: "Cool"},
+				"b": {ApiVersion: "example.org/v1", Kind: "Cool"},
+				"a": {ApiVersion: "example.org/v1", Kind: "Cool"},
+			},
+		},
+	}
+
+	cases := map[string]struct {
+		reason string
+		used   []string
+		want   []string
+	}{
+		"AllUsed": {
+			reason: "We should return no IDs if every requirement is used.",
+			used:   []string{"a", "b", "c"},
+			want:   []string{},
+		},
+		"SomeUnused": {
+			reason: "We should return the sorted IDs of unused requirements, ignoring used IDs that aren't required.",
+			used:   []string{"b", "d"},
+			want:   []string{"a", "c"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := UnusedRequirements(rsp, tc.used)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nUnusedRequirements(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRequestExtraFromRef(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "example.org", Version: "v1", Kind: "Network"}
+	req := &v1beta1.RunFunctionRequest{
+		Observed: &v1beta1.State{Composite: &v1beta1.Resource{
+			Resource: resource.MustStructJSON(`{"spec":{"networkRef":{"name":"cool-network"},"empty":"","replicas":3}}`),
+		}},
+	}
+
+	type want struct {
+		rsp *v1beta1.RunFunctionResponse
+		err bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		path   string
+		want   want
+	}{
+		"NotSet": {
+			reason: "We should return an error if the field path isn't set.",
+			path:   "spec.subnetRef.name",
+			want:   want{rsp: &v1beta1.RunFunctionResponse{}, err: true},
+		},
+		"NotString": {
+			reason: "We should return an error if the field path isn't a string.",
+			path:   "spec.replicas",
+			want:   want{rsp: &v1beta1.RunFunctionResponse{}, err: true},
+		},
+		"Empty": {
+			reason: "We should return an error if the field path is an empty string.",
+			path:   "spec.empty",
+			want:   want{rsp: &v1beta1.RunFunctionResponse{}, err: true},
+		},
+		"Success": {
+			reason: "We should require the extra resource named by the field path.",
+			path:   "spec.networkRef.name",
+			want: want{rsp: &v1beta1.RunFunctionResponse{
+				Requirements: &v1beta1.Requirements{
+					ExtraResources: map[string]*v1beta1.ResourceSelector{
+						"network": {
+							ApiVersion: "example.org/v1",
+							Kind:       "Network",
+							Match:      &v1beta1.ResourceSelector_MatchName{MatchName: "cool-network"},
+						},
+					},
+				},
+			}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := &v1beta1.RunFunctionResponse{}
+			err := RequestExtraFromRef(rsp, req, "network", tc.path, gvk)
+			if diff := cmp.Diff(tc.want.rsp, rsp, protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\nRequestExtraFromRef(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, err != nil); diff != "" {
+				t.Errorf("\n%s\nRequestExtraFromRef(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestResourceSelectorBuilder(t *testing.T) {
+	b := NewResourceSelector(schema.GroupVersionKind{Group: "example.org", Version: "v1", Kind: "Cool"})
+
+	cases := map[string]struct {
+		reason string
+		got    *v1beta1.ResourceSelector
+		want   *v1beta1.ResourceSelector
+	}{
+		"ByName": {
+			reason: "We should build a selector that matches by name.",
+			got:    b.ByName("cool"),
+			want: &v1beta1.ResourceSelector{
+				ApiVersion: "example.org/v1",
+				Kind:       "Cool",
+				Match:      &v1beta1.ResourceSelector_MatchName{MatchName: "cool"},
+			},
+		},
+		"ByLabels": {
+			reason: "We should build a selector that matches by labels.",
+			got:    b.ByLabels(map[string]string{"app": "cool"}),
+			want: &v1beta1.ResourceSelector{
+				ApiVersion: "example.org/v1",
+				Kind:       "Cool",
+				Match:      &v1beta1.ResourceSelector_MatchLabels{MatchLabels: &v1beta1.MatchLabels{Labels: map[string]string{"app": "cool"}}},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, tc.got, protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\nResourceSelectorBuilder: -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestSetEnvironment(t *testing.T) {
+	rsp := &v1beta1.RunFunctionResponse{}
+	env := &unstructured.Unstructured{Object: map[string]any{"region": "us-east-1"}}
+
+	if err := SetEnvironment(rsp, env); err != nil {
+		t.Fatalf("SetEnvironment(...): unexpected error: %v", err)
+	}
+
+	want := &v1beta1.RunFunctionResponse{
+		Context: &structpb.Struct{Fields: map[string]*structpb.Value{
+			fncontext.KeyEnvironment: structpb.NewStructValue(resource.MustStructJSON(`{"region":"us-east-1"}`)),
+		}},
+	}
+	if diff := cmp.Diff(want, rsp, protocmp.Transform()); diff != "" {
+		t.Errorf("SetEnvironment(...): -want, +got:\n%s", diff)
+	}
+}
+
+func TestSetDebug(t *testing.T) {
+	rsp := &v1beta1.RunFunctionResponse{}
+	if err := SetDebug(rsp, "template", "rendered"); err != nil {
+		t.Fatalf("SetDebug(...): unexpected error: %v", err)
+	}
+	if err := SetDebug(rsp, "values", map[string]any{"replicas": 3}); err != nil {
+		t.Fatalf("SetDebug(...): unexpected error: %v", err)
+	}
+
+	want := &v1beta1.RunFunctionResponse{
+		Context: &structpb.Struct{Fields: map[string]*structpb.Value{
+			fncontext.KeyDebug: structpb.NewStructValue(resource.MustStructJSON(`{"template":"rendered","values":{"replicas":3}}`)),
+		}},
+	}
+	if diff := cmp.Diff(want, rsp, protocmp.Transform()); diff != "" {
+		t.Errorf("SetDebug(...): -want, +got:\n%s", diff)
+	}
+}
+
+func TestSetDesiredComposedResources(t *testing.T) {
+	type args struct {
+		rsp  *v1beta1.RunFunctionResponse
+		dcds map[resource.Name]*resource.DesiredComposed
+	}
+	type want struct {
+		rsp *v1beta1.RunFunctionResponse
+		err error
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"Success": {
+			reason: "We should set desired composed resources, including their readiness.",
+			args: args{
+				rsp: &v1beta1.RunFunctionResponse{},
+				dcds: map[resource.Name]*resource.DesiredComposed{
+					"cool-resource": {
+						Resource: &composed.Unstructured{Unstructured: unstructured.Unstructured{
+							Object: map[string]any{
+								"apiVersion": "test.crossplane.io/v1",
+								"kind":       "Composed",
+							},
+						}},
+						Ready: resource.ReadyTrue,
+					},
+				},
+			},
+			want: want{
+				rsp: &v1beta1.RunFunctionResponse{
+					Desired: &v1beta1.State{
+						Resources: map[string]*v1beta1.Resource{
+							"cool-resource": {
+								Resource: resource.MustStructJSON(`{
+									"apiVersion": "test.crossplane.io/v1",
+									"kind": "Composed"
+								}`),
+								Ready: v1beta1.Ready_READY_TRUE,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := SetDesiredComposedResources(tc.args.rsp, tc.args.dcds)
+
+			if diff := cmp.Diff(tc.want.rsp, tc.args.rsp, protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\nSetDesiredComposedResources(...): -want rsp, +got rsp:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nSetDesiredComposedResources(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestDesiredHash(t *testing.T) {
+	a := &v1beta1.RunFunctionResponse{
+		Desired: &v1beta1.State{
+			Resources: map[string]*v1beta1.Resource{
+				"a": {Resource: resource.MustStructJSON(`{"spec":{"a":1,"b":2}}`)},
+				"b": {Resource: resource.MustStructJSON(`{"spec":{"c":3}}`)},
+			},
+		},
+	}
+	b := &v1beta1.RunFunctionResponse{
+		Desired: &v1beta1.State{
+			Resources: map[string]*v1beta1.Resource{
+				"b": {Resource: resource.MustStructJSON(`{"spec":{"c":3}}`)},
+				"a": {Resource: resource.MustStructJSON(`{"spec":{"b":2,"a":1}}`)},
+			},
+		},
+	}
+	c := &v1beta1.RunFunctionResponse{
+		Desired: &v1beta1.State{
+			Resources: map[string]*v1beta1.Resource{
+				"a": {Resource: resource.MustStructJSON(`{"spec":{"a":1,"b":3}}`)},
+			},
+		},
+	}
+
+	ha, err := DesiredHash(a)
+	if err != nil {
+		t.Fatalf("DesiredHash(a): unexpected error: %v", err)
+	}
+	hb, err := DesiredHash(b)
+	if err != nil {
+		t.Fatalf("DesiredHash(b): unexpected error: %v", err)
+	}
+	hc, err := DesiredHash(c)
+	if err != nil {
+		t.Fatalf("DesiredHash(c): unexpected error: %v", err)
+	}
+
+	if ha != hb {
+		t.Errorf("DesiredHash(...): equivalent desired state should have the same hash, got %q and %q", ha, hb)
+	}
+	if ha == hc {
+		t.Errorf("DesiredHash(...): different desired state should have different hashes, got %q for both", ha)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	type args struct {
+		dst *v1beta1.RunFunctionResponse
+		src *v1beta1.RunFunctionResponse
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   *v1beta1.RunFunctionResponse
+	}{
+		"EmptySource": {
+			reason: "Merging an empty response should not change the destination.",
+			args: args{
+				dst: &v1beta1.RunFunctionResponse{
+					Meta:    &v1beta1.ResponseMeta{Tag: "hi", Ttl: durationpb.New(DefaultTTL)},
+					Results: []*v1beta1.Result{{Severity: v1beta1.Severity_SEVERITY_NORMAL, Message: "dst"}},
+				},
+				src: &v1beta1.RunFunctionResponse{},
+			},
+			want: &v1beta1.RunFunctionResponse{
+				Meta:    &v1beta1.ResponseMeta{Tag: "hi", Ttl: durationpb.New(DefaultTTL)},
+				Results: []*v1beta1.Result{{Severity: v1beta1.Severity_SEVERITY_NORMAL, Message: "dst"}},
+			},
+		},
+		"Merge": {
+			reason: "Merging should union maps, with src winning conflicts, append results, and take the shorter TTL.",
+			args: args{
+				dst: &v1beta1.RunFunctionResponse{
+					Meta: &v1beta1.ResponseMeta{Tag: "hi", Ttl: durationpb.New(DefaultTTL)},
+					Desired: &v1beta1.State{
+						Resources: map[string]*v1beta1.Resource{
+							"a": {Ready: v1beta1.Ready_READY_FALSE},
+							"b": {Ready: v1beta1.Ready_READY_FALSE},
+						},
+					},
+					Results: []*v1beta1.Result{{Severity: v1beta1.Severity_SEVERITY_NORMAL, Message: "dst"}},
+					Context: &structpb.Struct{Fields: map[string]*structpb.Value{
+						"a": structpb.NewStringValue("dst"),
+					}},
+				},
+				src: &v1beta1.RunFunctionResponse{
+					Meta: &v1beta1.ResponseMeta{Tag: "hi", Ttl: durationpb.New(10 * time.Second)},
+					Desired: &v1beta1.State{
+						Resources: map[string]*v1beta1.Resource{
+							"b": {Ready: v1beta1.Ready_READY_TRUE},
+							"c": {Ready: v1beta1.Ready_READY_TRUE},
+						},
+					},
+					Results: []*v1beta1.Result{{Severity: v1beta1.Severity_SEVERITY_WARNING, Message: "src"}},
+					Context: &structpb.Struct{Fields: map[string]*structpb.Value{
+						"a": structpb.NewStringValue("src"),
+						"b": structpb.NewStringValue("src"),
+					}},
+					Requirements: &v1beta1.Requirements{
+						ExtraResources: map[string]*v1beta1.ResourceSelector{
+							"cool": {ApiVersion: "example.org/v1", Kind: "Cool"},
+						},
+					},
+				},
+			},
+			want: &v1beta1.RunFunctionResponse{
+				Meta: &v1beta1.ResponseMeta{Tag: "hi", Ttl: durationpb.New(10 * time.Second)},
+				Desired: &v1beta1.State{
+					Resources: map[string]*v1beta1.Resource{
+						"a": {Ready: v1beta1.Ready_READY_FALSE},
+						"b": {Ready: v1beta1.Ready_READY_TRUE},
+						"c": {Ready: v1beta1.Ready_READY_TRUE},
+					},
+				},
+				Results: []*v1beta1.Result{
+					{Severity: v1beta1.Severity_SEVERITY_NORMAL, Message: "dst"},
+					{Severity: v1beta1.Severity_SEVERITY_WARNING, Message: "src"},
+				},
+				Context: &structpb.Struct{Fields: map[string]*structpb.Value{
+					"a": structpb.NewStringValue("src"),
+					"b": structpb.NewStringValue("src"),
+				}},
+				Requirements: &v1beta1.Requirements{
+					ExtraResources: map[string]*v1beta1.ResourceSelector{
+						"cool": {ApiVersion: "example.org/v1", Kind: "Cool"},
+					},
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			Merge(tc.args.dst, tc.args.src)
+			if diff := cmp.Diff(tc.want, tc.args.dst, protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\nMerge(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestResolveNameCollisions(t *testing.T) {
+	dst := func() *v1beta1.RunFunctionResponse {
+		return &v1beta1.RunFunctionResponse{Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{
+			"a":   {Ready: v1beta1.Ready_READY_FALSE},
+			"b":   {Ready: v1beta1.Ready_READY_FALSE},
+			"b-2": {Ready: v1beta1.Ready_READY_FALSE},
+		}}}
+	}
+	src := func() *v1beta1.RunFunctionResponse {
+		return &v1beta1.RunFunctionResponse{Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{
+			"a": {Resource: resource.MustStructJSON(`{"metadata":{"annotations":{"crossplane.io/composition-resource-name":"a"}}}`)},
+			"b": {Ready: v1beta1.Ready_READY_TRUE},
+			"c": {Ready: v1beta1.Ready_READY_TRUE},
+		}}}
+	}
+
+	type want struct {
+		src *v1beta1.RunFunctionResponse
+		c   Collisions
+		err error
+	}
+
+	cases := map[string]struct {
+		reason   string
+		strategy CollisionStrategy
+		want     want
+	}{
+		"Error": {
+			reason:   "We should return an error listing the colliding names.",
+			strategy: CollisionError,
+			want: want{
+				src: src(),
+				c:   Collisions{Renamed: map[resource.Name]resource.Name{}, Dropped: []resource.Name{}},
+				err: errors.New("desired composed resource names collide: a, b"),
+			},
+		},
+		"FirstWins": {
+			reason:   "We should drop colliding src resources.",
+			strategy: CollisionFirstWins,
+			want: want{
+				src: &v1beta1.RunFunctionResponse{Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{
+					"c": {Ready: v1beta1.Ready_READY_TRUE},
+				}}},
+				c: Collisions{Renamed: map[resource.Name]resource.Name{}, Dropped: []resource.Name{"a", "b"}},
+			},
+		},
+		"Suffix": {
+			reason:   "We should rename colliding src resources to an unused name, updating their annotation.",
+			strategy: CollisionSuffix,
+			want: want{
+				src: &v1beta1.RunFunctionResponse{Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{
+					"a-2": {Resource: resource.MustStructJSON(`{"metadata":{"annotations":{"crossplane.io/composition-resource-name":"a-2"}}}`)},
+					"b-3": {Ready: v1beta1.Ready_READY_TRUE},
+					"c":   {Ready: v1beta1.Ready_READY_TRUE},
+				}}},
+				c: Collisions{Renamed: map[resource.Name]resource.Name{"a": "a-2", "b": "b-3"}, Dropped: []resource.Name{}},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			s := src()
+			c, err := ResolveNameCollisions(dst(), s, tc.strategy)
+
+			if diff := cmp.Diff(tc.want.src, s, protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\nResolveNameCollisions(...): -want src, +got src:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.c, c); diff != "" {
+				t.Errorf("\n%s\nResolveNameCollisions(...): -want collisions, +got collisions:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nResolveNameCollisions(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestCheckResourceNames(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		rsp    *v1beta1.RunFunctionResponse
+		want   error
+	}{
+		"NoAnnotation": {
+			reason: "Desired resources without the annotation should pass.",
+			rsp: &v1beta1.RunFunctionResponse{
+				Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{
+					"foo": {Resource: resource.MustStructJSON(`{"metadata":{"name":"cool"}}`)},
+				}},
+			},
+		},
+		"Match": {
+			reason: "Desired resources whose annotation matches their key should pass.",
+			rsp: &v1beta1.RunFunctionResponse{
+				Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{
+					"foo": {Resource: resource.MustStructJSON(`{"metadata":{"annotations":{"crossplane.io/composition-resource-name":"foo"}}}`)},
+				}},
+			},
+		},
+		"Mismatch": {
+			reason: "Desired resources whose annotation doesn't match their key should return an error.",
+			rsp: &v1beta1.RunFunctionResponse{
+				Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{
+					"foo": {Resource: resource.MustStructJSON(`{"metadata":{"annotations":{"crossplane.io/composition-resource-name":"bar"}}}`)},
+				}},
+			},
+			want: errors.New(`desired composed resource "foo" has crossplane.io/composition-resource-name annotation "bar"`),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := CheckResourceNames(tc.rsp)
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nCheckResourceNames(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestAssertDesiredUnchanged(t *testing.T) {
+	req := &v1beta1.RunFunctionRequest{
+		Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{
+			"foo": {Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"Cool"}`)},
+		}},
+	}
+
+	cases := map[string]struct {
+		reason string
+		mutate func(rsp *v1beta1.RunFunctionResponse)
+		want   error
+	}{
+		"Unchanged": {
+			reason: "A response that only adds results and context should pass.",
+			mutate: func(rsp *v1beta1.RunFunctionResponse) {
+				Normal(rsp, "looks good")
+				SetContextKey(rsp, "checked", structpb.NewBoolValue(true))
+			},
+		},
+		"Changed": {
+			reason: "A response that changes the desired state should return an error.",
+			mutate: func(rsp *v1beta1.RunFunctionResponse) {
+				rsp.Desired.Resources["foo"].Ready = v1beta1.Ready_READY_TRUE
+			},
+			want: errors.New("observe-only response changed the desired state"),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := ToObserveOnly(req, DefaultTTL)
+			tc.mutate(rsp)
+			err := AssertDesiredUnchanged(rsp, req)
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nAssertDesiredUnchanged(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestCheckTag(t *testing.T) {
+	req := &v1beta1.RunFunctionRequest{Meta: &v1beta1.RequestMeta{Tag: "cool-tag"}}
+
+	cases := map[string]struct {
+		reason string
+		rsp    *v1beta1.RunFunctionResponse
+		want   error
+	}{
+		"Match": {
+			reason: "A response with the request's tag should pass.",
+			rsp:    To(req, DefaultTTL),
+		},
+		"NoTag": {
+			reason: "A response without the request's tag should return an error.",
+			rsp:    &v1beta1.RunFunctionResponse{},
+			want:   errors.New(`response tag "" doesn't match request tag "cool-tag"`),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := CheckTag(tc.rsp, req)
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nCheckTag(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestCheckDesiredGVKs(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		rsp    *v1beta1.RunFunctionResponse
+		want   error
+	}{
+		"Valid": {
+			reason: "Desired resources with an apiVersion and kind should pass.",
+			rsp: &v1beta1.RunFunctionResponse{
+				Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{
+					"foo": {Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"Cool"}`)},
+				}},
+			},
+		},
+		"NoAPIVersion": {
+			reason: "Desired resources without an apiVersion should return an error.",
+			rsp: &v1beta1.RunFunctionResponse{
+				Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{
+					"foo": {Resource: resource.MustStructJSON(`{"kind":"Cool"}`)},
+				}},
+			},
+			want: errors.New(`desired composed resource "foo" has no apiVersion`),
+		},
+		"InvalidAPIVersion": {
+			reason: "Desired resources with an unparseable apiVersion should return an error.",
+			rsp: &v1beta1.RunFunctionResponse{
+				Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{
+					"foo": {Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1/extra","kind":"Cool"}`)},
+				}},
+			},
+			want: errors.Wrap(errors.New("unexpected GroupVersion string: example.org/v1/extra"), `desired composed resource "foo" has invalid apiVersion`),
+		},
+		"NoKind": {
+			reason: "Desired resources without a kind should return an error.",
+			rsp: &v1beta1.RunFunctionResponse{
+				Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{
+					"foo": {Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1"}`)},
+				}},
+			},
+			want: errors.New(`desired composed resource "foo" has no kind`),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := CheckDesiredGVKs(tc.rsp)
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nCheckDesiredGVKs(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestCarryForwardComposed(t *testing.T) {
+	req := &v1beta1.RunFunctionRequest{
+		Observed: &v1beta1.State{Resources: map[string]*v1beta1.Resource{
+			"a": {Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"A","metadata":{"name":"a","uid":"some-uid"},"status":{"ready":true}}`)},
+			"b": {Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"B"}`)},
+		}},
+	}
+
+	type want struct {
+		rsp *v1beta1.RunFunctionResponse
+		err error
+	}
+
+	cases := map[string]struct {
+		reason string
+		names  []resource.Name
+		want   want
+	}{
+		"NotObserved": {
+			reason: "We should return an error and change nothing if a named resource isn't observed.",
+			names:  []resource.Name{"a", "c"},
+			want: want{
+				rsp: &v1beta1.RunFunctionResponse{},
+				err: errors.New(`composed resource "c" is not observed`),
+			},
+		},
+		"CarryForward": {
+			reason: "We should copy only the named observed resources into desired, sanitized.",
+			names:  []resource.Name{"a"},
+			want: want{
+				rsp: &v1beta1.RunFunctionResponse{
+					Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{
+						"a": {Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"A","metadata":{"name":"a"}}`)},
+					}},
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := &v1beta1.RunFunctionResponse{}
+			err := CarryForwardComposed(rsp, req, tc.names...)
+
+			if diff := cmp.Diff(tc.want.rsp, rsp, protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\nCarryForwardComposed(...): -want rsp, +got rsp:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nCarryForwardComposed(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestSkipIfDeleting(t *testing.T) {
+	type want struct {
+		skip bool
+		rsp  *v1beta1.RunFunctionResponse
+	}
+
+	cases := map[string]struct {
+		reason string
+		req    *v1beta1.RunFunctionRequest
+		want   want
+	}{
+		"NoObservedComposite": {
+			reason: "We shouldn't skip if there is no observed composite resource.",
+			req:    &v1beta1.RunFunctionRequest{},
+			want:   want{skip: false, rsp: &v1beta1.RunFunctionResponse{}},
+		},
+		"NotBeingDeleted": {
+			reason: "We shouldn't skip if the observed composite resource isn't being deleted.",
+			req: &v1beta1.RunFunctionRequest{Observed: &v1beta1.State{Composite: &v1beta1.Resource{
+				Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"XR","metadata":{"name":"cool"}}`),
+			}}},
+			want: want{skip: false, rsp: &v1beta1.RunFunctionResponse{}},
+		},
+		"BeingDeleted": {
+			reason: "We should skip, and add a normal result, if the observed composite resource is being deleted.",
+			req: &v1beta1.RunFunctionRequest{Observed: &v1beta1.State{Composite: &v1beta1.Resource{
+				Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"XR","metadata":{"name":"cool","deletionTimestamp":"2023-01-01T00:00:00Z"}}`),
+			}}},
+			want: want{
+				skip: true,
+				rsp: &v1beta1.RunFunctionResponse{Results: []*v1beta1.Result{{
+					Severity: v1beta1.Severity_SEVERITY_NORMAL,
+					Message:  "composite resource is being deleted - not composing resources",
+				}}},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := &v1beta1.RunFunctionResponse{}
+			skip := SkipIfDeleting(rsp, tc.req)
+
+			if diff := cmp.Diff(tc.want.skip, skip); diff != "" {
+				t.Errorf("\n%s\nSkipIfDeleting(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.rsp, rsp, protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\nSkipIfDeleting(...): -want rsp, +got rsp:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestGateOnReady(t *testing.T) {
+	dependent := &resource.DesiredComposed{Resource: &composed.Unstructured{Unstructured: unstructured.Unstructured{
+		Object: map[string]any{"apiVersion": "example.org/v1", "kind": "B"},
+	}}}
+	ready := `{"apiVersion":"example.org/v1","kind":"A","status":{"conditions":[{"type":"Ready","status":"True"}]}}`
+	unready := `{"apiVersion":"example.org/v1","kind":"A","status":{"conditions":[{"type":"Ready","status":"False"}]}}`
+
+	type want struct {
+		rsp *v1beta1.RunFunctionResponse
+		err error
+	}
+
+	cases := map[string]struct {
+		reason string
+		req    *v1beta1.RunFunctionRequest
+		want   want
+	}{
+		"DependencyNotObserved": {
+			reason: "We should wait if the dependency hasn't been observed.",
+			req:    &v1beta1.RunFunctionRequest{},
+			want: want{
+				rsp: &v1beta1.RunFunctionResponse{
+					Results: []*v1beta1.Result{{
+						Severity: v1beta1.Severity_SEVERITY_NORMAL,
+						Message:  `waiting for composed resource "a" to be ready before creating "b"`,
+					}},
+				},
+			},
+		},
+		"DependencyNotReady": {
+			reason: "We should wait if the dependency isn't ready.",
+			req: &v1beta1.RunFunctionRequest{
+				Observed: &v1beta1.State{Resources: map[string]*v1beta1.Resource{
+					"a": {Resource: resource.MustStructJSON(unready)},
+				}},
+			},
+			want: want{
+				rsp: &v1beta1.RunFunctionResponse{
+					Results: []*v1beta1.Result{{
+						Severity: v1beta1.Severity_SEVERITY_NORMAL,
+						Message:  `waiting for composed resource "a" to be ready before creating "b"`,
+					}},
+				},
+			},
+		},
+		"DependencyReady": {
+			reason: "We should add the dependent resource if the dependency is ready.",
+			req: &v1beta1.RunFunctionRequest{
+				Observed: &v1beta1.State{Resources: map[string]*v1beta1.Resource{
+					"a": {Resource: resource.MustStructJSON(ready)},
+				}},
+			},
+			want: want{
+				rsp: &v1beta1.RunFunctionResponse{
+					Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{
+						"b": {Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"B"}`)},
+					}},
+				},
+			},
+		},
+		"DependentAlreadyExists": {
+			reason: "We should add the dependent resource if it already exists, even if the dependency isn't ready.",
+			req: &v1beta1.RunFunctionRequest{
+				Observed: &v1beta1.State{Resources: map[string]*v1beta1.Resource{
+					"a": {Resource: resource.MustStructJSON(unready)},
+					"b": {Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"B"}`)},
+				}},
+			},
+			want: want{
+				rsp: &v1beta1.RunFunctionResponse{
+					Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{
+						"b": {Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"B"}`)},
+					}},
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := &v1beta1.RunFunctionResponse{}
+			err := GateOnReady(rsp, tc.req, "a", dependent, "b")
+
+			if diff := cmp.Diff(tc.want.rsp, rsp, protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\nGateOnReady(...): -want rsp, +got rsp:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nGateOnReady(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestSetDesiredCompositeConditions(t *testing.T) {
+	oxr := &resource.Composite{Resource: composite.New()}
+	oxr.Resource.SetGeneration(3)
+
+	ready := xpv1.Condition{
+		Type:               xpv1.TypeReady,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.NewTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)),
+		Reason:             xpv1.ReasonAvailable,
+	}
+
+	type args struct {
+		rsp *v1beta1.RunFunctionResponse
+		c   []xpv1.Condition
+	}
+	type want struct {
+		rsp *v1beta1.RunFunctionResponse
+		err error
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"NoDesiredComposite": {
+			reason: "We should create a desired composite resource with the supplied conditions, recording the observed generation.",
+			args: args{
+				rsp: &v1beta1.RunFunctionResponse{},
+				c:   []xpv1.Condition{ready},
+			},
+			want: want{
+				rsp: &v1beta1.RunFunctionResponse{
+					Desired: &v1beta1.State{
+						Composite: &v1beta1.Resource{
+							Resource: resource.MustStructJSON(`{"status":{"conditions":[{"type":"Ready","status":"True","lastTransitionTime":"2024-01-01T00:00:00Z","reason":"Available","observedGeneration":3}]}}`),
+						},
+					},
+				},
+			},
+		},
+		"ExistingDesiredComposite": {
+			reason: "We should replace a condition of the same type, preserving other conditions and status fields.",
+			args: args{
+				rsp: &v1beta1.RunFunctionResponse{
+					Desired: &v1beta1.State{
+						Composite: &v1beta1.Resource{
+							Resource: resource.MustStructJSON(`{"status":{"widgets":9001,"conditions":[
+								{"type":"Ready","status":"False","lastTransitionTime":"2023-01-01T00:00:00Z","reason":"Creating"},
+								{"type":"Synced","status":"True","lastTransitionTime":"2023-01-01T00:00:00Z","reason":"ReconcileSuccess"}
+							]}}`),
+						},
+					},
+				},
+				c: []xpv1.Condition{ready},
+			},
+			want: want{
+				rsp: &v1beta1.RunFunctionResponse{
+					Desired: &v1beta1.State{
+						Composite: &v1beta1.Resource{
+							Resource: resource.MustStructJSON(`{"status":{"widgets":9001,"conditions":[
+								{"type":"Ready","status":"True","lastTransitionTime":"2024-01-01T00:00:00Z","reason":"Available","observedGeneration":3},
+								{"type":"Synced","status":"True","lastTransitionTime":"2023-01-01T00:00:00Z","reason":"ReconcileSuccess"}
+							]}}`),
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := SetDesiredCompositeConditions(tc.args.rsp, oxr, tc.args.c...)
+
+			if diff := cmp.Diff(tc.want.rsp, tc.args.rsp, protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\nSetDesiredCompositeConditions(...): -want rsp, +got rsp:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nSetDesiredCompositeConditions(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestSetDesiredCompositeStatus(t *testing.T) {
+	type args struct {
+		rsp    *v1beta1.RunFunctionResponse
+		status map[string]any
+	}
+	type want struct {
+		rsp *v1beta1.RunFunctionResponse
+		err error
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"NoDesiredComposite": {
+			reason: "We should create a desired composite resource with the supplied status.",
+			args: args{
+				rsp:    &v1beta1.RunFunctionResponse{},
+				status: map[string]any{"widgets": 9001},
+			},
+			want: want{
+				rsp: &v1beta1.RunFunctionResponse{
+					Desired: &v1beta1.State{
+						Composite: &v1beta1.Resource{
+							Resource: resource.MustStructJSON(`{"status":{"widgets":9001}}`),
+						},
+					},
+				},
+			},
+		},
+		"ExistingDesiredComposite": {
+			reason: "We should replace the supplied status fields, preserving everything else.",
+			args: args{
+				rsp: &v1beta1.RunFunctionResponse{
+					Desired: &v1beta1.State{
+						Composite: &v1beta1.Resource{
+							Resource:          resource.MustStructJSON(`{"spec":{"cool":true},"status":{"widgets":1,"gadgets":2}}`),
+							ConnectionDetails: map[string][]byte{"super": []byte("secret")},
+						},
+					},
+				},
+				status: map[string]any{"widgets": 9001},
+			},
+			want: want{
+				rsp: &v1beta1.RunFunctionResponse{
+					Desired: &v1beta1.State{
+						Composite: &v1beta1.Resource{
+							Resource:          resource.MustStructJSON(`{"spec":{"cool":true},"status":{"widgets":9001,"gadgets":2}}`),
+							ConnectionDetails: map[string][]byte{"super": []byte("secret")},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := SetDesiredCompositeStatus(tc.args.rsp, tc.args.status)
+
+			if diff := cmp.Diff(tc.want.rsp, tc.args.rsp, protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\nSetDesiredCompositeStatus(...): -want rsp, +got rsp:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nSetDesiredCompositeStatus(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestSetProgress(t *testing.T) {
+	rsp := &v1beta1.RunFunctionResponse{}
+	SetProgress(rsp, 2, 5, "creating database")
+
+	want := &v1beta1.RunFunctionResponse{
+		Context: &structpb.Struct{Fields: map[string]*structpb.Value{
+			fncontext.KeyProgress: structpb.NewStructValue(resource.MustStructJSON(`{"step":2,"total":5,"message":"creating database"}`)),
+		}},
+		Results: []*v1beta1.Result{{
+			Severity: v1beta1.Severity_SEVERITY_NORMAL,
+			Message:  "step 2/5: creating database",
+		}},
+	}
+	if diff := cmp.Diff(want, rsp, protocmp.Transform()); diff != "" {
+		t.Errorf("SetProgress(...): -want, +got:\n%s", diff)
+	}
+}
+
+func TestWarningWithLink(t *testing.T) {
+	type want struct {
+		rsp *v1beta1.RunFunctionResponse
+		err error
+	}
+
+	cases := map[string]struct {
+		reason string
+		url    string
+		want   want
+	}{
+		"InvalidURL": {
+			reason: "We should return an error and add no result if the URL isn't absolute.",
+			url:    "docs/known-issue",
+			want: want{
+				rsp: &v1beta1.RunFunctionResponse{},
+				err: errors.New(`invalid documentation URL "docs/known-issue" - must be an absolute HTTP or HTTPS URL`),
+			},
+		},
+		"ValidURL": {
+			reason: "We should add a warning with the URL appended to the message.",
+			url:    "https://example.org/docs#known-issue",
+			want: want{
+				rsp: &v1beta1.RunFunctionResponse{Results: []*v1beta1.Result{{
+					Severity: v1beta1.Severity_SEVERITY_WARNING,
+					Message:  "boom (see: https://example.org/docs#known-issue)",
+				}}},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := &v1beta1.RunFunctionResponse{}
+			err := WarningWithLink(rsp, errors.New("boom"), tc.url)
+
+			if diff := cmp.Diff(tc.want.rsp, rsp, protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\nWarningWithLink(...): -want rsp, +got rsp:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nWarningWithLink(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestFromFieldErrors(t *testing.T) {
+	rsp := &v1beta1.RunFunctionResponse{}
+	FromFieldErrors(rsp, field.ErrorList{
+		field.Required(field.NewPath("spec", "widgets"), "widgets are required"),
+		field.Invalid(field.NewPath("spec", "gadgets"), -1, "must be positive"),
+		field.NotSupported(field.NewPath("spec", "mode"), "loud", []string{"quiet"}),
+	})
+
+	want := &v1beta1.RunFunctionResponse{
+		Results: []*v1beta1.Result{
+			{Severity: v1beta1.Severity_SEVERITY_FATAL, Message: "spec.widgets: Required value: widgets are required"},
+			{Severity: v1beta1.Severity_SEVERITY_FATAL, Message: "spec.gadgets: Invalid value: -1: must be positive"},
+			{Severity: v1beta1.Severity_SEVERITY_WARNING, Message: `spec.mode: Unsupported value: "loud": supported values: "quiet"`},
+		},
+	}
+	if diff := cmp.Diff(want, rsp, protocmp.Transform()); diff != "" {
+		t.Errorf("FromFieldErrors(...): -want, +got:\n%s", diff)
+	}
+}
+
+func TestTruncateDesiredComposed(t *testing.T) {
+	type want struct {
+		rsp     *v1beta1.RunFunctionResponse
+		dropped int
+	}
+
+	cases := map[string]struct {
+		reason string
+		rsp    *v1beta1.RunFunctionResponse
+		max    int
+		want   want
+	}{
+		"WithinLimit": {
+			reason: "We shouldn't drop anything if the response is within the limit.",
+			rsp: &v1beta1.RunFunctionResponse{
+				Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{"a": {}}},
+			},
+			max: 1,
+			want: want{
+				rsp: &v1beta1.RunFunctionResponse{
+					Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{"a": {}}},
+				},
+			},
+		},
+		"ExceedsLimit": {
+			reason: "We should keep the first resources in name order, and drop the rest.",
+			rsp: &v1beta1.RunFunctionResponse{
+				Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{"c": {}, "a": {}, "b": {}}},
+			},
+			max: 1,
+			want: want{
+				rsp: &v1beta1.RunFunctionResponse{
+					Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{"a": {}}},
+				},
+				dropped: 2,
+			},
+		},
+		"NegativeLimit": {
+			reason: "We should treat a negative limit as zero, and drop everything.",
+			rsp: &v1beta1.RunFunctionResponse{
+				Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{"a": {}, "b": {}}},
+			},
+			max: -1,
+			want: want{
+				rsp: &v1beta1.RunFunctionResponse{
+					Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{}},
+				},
+				dropped: 2,
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			dropped := TruncateDesiredComposed(tc.rsp, tc.max)
+			if diff := cmp.Diff(tc.want.rsp, tc.rsp, protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\nTruncateDesiredComposed(...): -want rsp, +got rsp:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.dropped, dropped); diff != "" {
+				t.Errorf("\n%s\nTruncateDesiredComposed(...): -want dropped, +got dropped:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestThrottleDesiredComposed(t *testing.T) {
+	type args struct {
+		rsp       *v1beta1.RunFunctionResponse
+		req       *v1beta1.RunFunctionRequest
+		batchSize int
+		order     []resource.Name
+	}
+	type want struct {
+		rsp      *v1beta1.RunFunctionResponse
+		deferred int
+		err      error
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"WithinBatch": {
+			reason: "We shouldn't defer anything if there are no more new resources than the batch size.",
+			args: args{
+				rsp: &v1beta1.RunFunctionResponse{
+					Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{"a": {}, "b": {}}},
+				},
+				req:       &v1beta1.RunFunctionRequest{},
+				batchSize: 2,
+				order:     []resource.Name{"a", "b"},
+			},
+			want: want{
+				rsp: &v1beta1.RunFunctionResponse{
+					Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{"a": {}, "b": {}}},
+				},
+			},
+		},
+		"DeferNextBatches": {
+			reason: "We should keep observed resources, keep the next batch of new resources in order, and defer the rest.",
+			args: args{
+				rsp: &v1beta1.RunFunctionResponse{
+					Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{"a": {}, "b": {}, "c": {}, "d": {}, "x": {}}},
+				},
+				req: &v1beta1.RunFunctionRequest{
+					Observed: &v1beta1.State{Resources: map[string]*v1beta1.Resource{"d": {}}},
+				},
+				batchSize: 1,
+				order:     []resource.Name{"d", "c", "b", "a"},
+			},
+			want: want{
+				rsp: &v1beta1.RunFunctionResponse{
+					Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{"c": {}, "d": {}, "x": {}}},
+					Results: []*v1beta1.Result{
+						{
+							Severity: v1beta1.Severity_SEVERITY_NORMAL,
+							Message:  "created 1 of 4 composed resources, creating 1 more - deferring 2 to a later run",
+						},
+					},
+				},
+				deferred: 2,
+			},
+		},
+		"InvalidBatchSize": {
+			reason: "We should return an error, and leave the response untouched, if the batch size is less than one.",
+			args: args{
+				rsp: &v1beta1.RunFunctionResponse{
+					Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{"a": {}}},
+				},
+				req:       &v1beta1.RunFunctionRequest{},
+				batchSize: 0,
+				order:     []resource.Name{"a"},
+			},
+			want: want{
+				rsp: &v1beta1.RunFunctionResponse{
+					Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{"a": {}}},
+				},
+				err: errors.New("batch size must be at least 1, got 0"),
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			deferred, err := ThrottleDesiredComposed(tc.args.rsp, tc.args.req, tc.args.batchSize, tc.args.order)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nThrottleDesiredComposed(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.rsp, tc.args.rsp, protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\nThrottleDesiredComposed(...): -want rsp, +got rsp:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.deferred, deferred); diff != "" {
+				t.Errorf("\n%s\nThrottleDesiredComposed(...): -want deferred, +got deferred:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestNormalWithData(t *testing.T) {
+	rsp := &v1beta1.RunFunctionResponse{}
+	if err := NormalWithData(rsp, "first", map[string]any{"widgets": 1}); err != nil {
+		t.Fatalf("NormalWithData(...): unexpected error: %v", err)
+	}
+	if err := NormalWithData(rsp, "second", map[string]any{"gadgets": "many"}); err != nil {
+		t.Fatalf("NormalWithData(...): unexpected error: %v", err)
+	}
+
+	want := &v1beta1.RunFunctionResponse{
+		Results: []*v1beta1.Result{
+			{Severity: v1beta1.Severity_SEVERITY_NORMAL, Message: "first"},
+			{Severity: v1beta1.Severity_SEVERITY_NORMAL, Message: "second"},
+		},
+		Context: resource.MustStructJSON(`{
+			"function-sdk-go.crossplane.io/result-data": [
+				{"message": "first", "data": {"widgets": 1}},
+				{"message": "second", "data": {"gadgets": "many"}}
+			]
+		}`),
+	}
+	if diff := cmp.Diff(want, rsp, protocmp.Transform()); diff != "" {
+		t.Errorf("NormalWithData(...): -want, +got:\n%s", diff)
+	}
+}
+
+func TestWarningForField(t *testing.T) {
+	rsp := &v1beta1.RunFunctionResponse{}
+	WarningForField(rsp, "spec.parameters.size", errors.New("too large"))
+
+	want := &v1beta1.RunFunctionResponse{
+		Results: []*v1beta1.Result{
+			{Severity: v1beta1.Severity_SEVERITY_WARNING, Message: "spec.parameters.size: too large"},
+		},
+		Context: resource.MustStructJSON(`{
+			"function-sdk-go.crossplane.io/result-data": [
+				{"message": "spec.parameters.size: too large", "data": {"fieldPath": "spec.parameters.size"}}
+			]
+		}`),
+	}
+	if diff := cmp.Diff(want, rsp, protocmp.Transform()); diff != "" {
+		t.Errorf("WarningForField(...): -want, +got:\n%s", diff)
+	}
+}
+
+func TestPendingDeletions(t *testing.T) {
+	req := &v1beta1.RunFunctionRequest{
+		Observed: &v1beta1.State{Resources: map[string]*v1beta1.Resource{"a": {}, "b": {}, "c": {}}},
+	}
+	rsp := &v1beta1.RunFunctionResponse{
+		Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{"b": {}, "d": {}}},
+	}
+
+	want := []resource.Name{"a", "c"}
+	if diff := cmp.Diff(want, PendingDeletions(rsp, req)); diff != "" {
+		t.Errorf("PendingDeletions(...): -want, +got:\n%s", diff)
+	}
+}
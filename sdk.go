@@ -18,20 +18,31 @@ limitations under the License.
 package function
 
 import (
+	"context"
 	"crypto/tls"
-	"crypto/x509"
 	"net"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	ginsecure "google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
 
+	fncontext "github.com/crossplane/function-sdk-go/context"
 	"github.com/crossplane/function-sdk-go/logging"
 	"github.com/crossplane/function-sdk-go/proto/v1beta1"
+	"github.com/crossplane/function-sdk-go/response"
 )
 
 // Default ServeOptions.
@@ -45,6 +56,45 @@ type ServeOptions struct {
 	Network     string
 	Address     string
 	Credentials credentials.TransportCredentials
+
+	// Logger is used to derive the request-scoped logger available via
+	// CtxFrom.
+	Logger logging.Logger
+
+	// MaxDesiredResources is the maximum number of desired composed resources
+	// a Function may return. Zero means no limit.
+	MaxDesiredResources int
+
+	// Compression enables gzip compression of responses.
+	Compression bool
+
+	// UnaryInterceptors are run, in order, before the SDK's own interceptors.
+	UnaryInterceptors []grpc.UnaryServerInterceptor
+
+	// Ready is closed when the Function is ready to serve requests. A nil
+	// channel means the Function is always ready.
+	Ready <-chan struct{}
+
+	// MaxConnectionAge is the maximum amount of time a connection may exist
+	// before it is closed. Zero means no limit.
+	MaxConnectionAge time.Duration
+
+	// ContextGuard skips running the Function if a request's context is
+	// already done when it arrives.
+	ContextGuard bool
+
+	// Debug preserves debugging artifacts in responses.
+	Debug bool
+
+	// ResponseInterceptors are run, in order, on every successful response.
+	ResponseInterceptors []func(rsp *v1beta1.RunFunctionResponse)
+
+	// OnStart hooks are run, in order, before the Function starts serving.
+	OnStart []func() error
+
+	// OnStop hooks are run, in reverse order, after the Function stops
+	// serving.
+	OnStop []func()
 }
 
 // A ServeOption configures how a Function is served.
@@ -73,31 +123,35 @@ func MTLSCertificates(dir string) ServeOption {
 			// return an error due to having no credentials specified.
 			return nil
 		}
-		crt, err := tls.LoadX509KeyPair(
-			filepath.Clean(filepath.Join(dir, "tls.crt")),
-			filepath.Clean(filepath.Join(dir, "tls.key")),
-		)
+		cfg, err := loadTLSConfig(dir)
 		if err != nil {
-			return errors.Wrap(err, "cannot load X509 keypair")
+			return err
 		}
+		o.Credentials = credentials.NewTLS(cfg)
+		return nil
+	}
+}
 
-		ca, err := os.ReadFile(filepath.Clean(filepath.Join(dir, "ca.crt")))
-		if err != nil {
-			return errors.Wrap(err, "cannot read CA certificate")
+// WithCertWatcher is like MTLSCertificates, but reloads the certificates when
+// they change - for example when cert-manager rotates them. This avoids having
+// to restart the Function to pick up new certificates. The certificates are
+// checked for changes each time a client connects. If they can't be loaded,
+// for example because they're being replaced, the previous certificates are
+// used until they can be. Like MTLSCertificates, it does nothing if dir is
+// empty.
+func WithCertWatcher(dir string) ServeOption {
+	return func(o *ServeOptions) error {
+		if dir == "" {
+			return nil
 		}
-
-		pool := x509.NewCertPool()
-		if !pool.AppendCertsFromPEM(ca) {
-			return errors.New("invalid CA certificate")
+		w, err := newCertWatcher(dir)
+		if err != nil {
+			return err
 		}
-
 		o.Credentials = credentials.NewTLS(&tls.Config{
-			MinVersion:   tls.VersionTLS12,
-			Certificates: []tls.Certificate{crt},
-			ClientCAs:    pool,
-			ClientAuth:   tls.RequireAndVerifyClientCert,
+			MinVersion:         tls.VersionTLS12,
+			GetConfigForClient: w.GetConfigForClient,
 		})
-
 		return nil
 	}
 }
@@ -114,36 +168,453 @@ func Insecure(insecure bool) ServeOption {
 	}
 }
 
+// WithLogger configures the logger from which the request-scoped logger
+// available via CtxFrom is derived. A no-op logger is used by default.
+func WithLogger(log logging.Logger) ServeOption {
+	return func(o *ServeOptions) error {
+		o.Logger = log
+		return nil
+	}
+}
+
+// WithMaxDesiredResources limits the number of desired composed resources the
+// Function may return. If a response exceeds the limit the Function's desired
+// state is discarded, and a fatal result is returned instead. This guards
+// against buggy Functions overwhelming Crossplane with enormous responses. There
+// is no limit by default.
+func WithMaxDesiredResources(n int) ServeOption {
+	return func(o *ServeOptions) error {
+		if n < 0 {
+			return errors.Errorf("maximum desired resources must not be negative, got %d", n)
+		}
+		o.MaxDesiredResources = n
+		return nil
+	}
+}
+
+// WithCompression enables gzip compression of RunFunctionResponses, for
+// clients that support it. Compression reduces the bandwidth used between
+// Crossplane and the Function, which can be significant for responses with many
+// desired composed resources, at the cost of additional CPU on both sides.
+// Compression is disabled by default.
+func WithCompression() ServeOption {
+	return func(o *ServeOptions) error {
+		o.Compression = true
+		return nil
+	}
+}
+
+// WithUnaryInterceptor adds a gRPC unary interceptor to the server, for example
+// to add authentication, logging, or metrics. This option may be supplied
+// multiple times. Interceptors run in the order they were supplied, and before
+// the SDK's own interceptors. This means they run before the request-scoped
+// Context is available via CtxFrom.
+func WithUnaryInterceptor(i grpc.UnaryServerInterceptor) ServeOption {
+	return func(o *ServeOptions) error {
+		o.UnaryInterceptors = append(o.UnaryInterceptors, i)
+		return nil
+	}
+}
+
+// WithResponseInterceptor adds a function that is called with every
+// RunFunctionResponse the Function returns successfully, before it is sent.
+// Use it to enforce policies across all responses - for example to add a common
+// result, or to redact context. This option may be supplied multiple times.
+// Response interceptors run in the order they were supplied.
+func WithResponseInterceptor(fn func(rsp *v1beta1.RunFunctionResponse)) ServeOption {
+	return func(o *ServeOptions) error {
+		o.ResponseInterceptors = append(o.ResponseInterceptors, fn)
+		return nil
+	}
+}
+
+// WithResultSource prefixes the message of every result the Function returns
+// with the supplied name, e.g. "[function-example] ". Use it to tell which
+// Function in a pipeline emitted a result - for example an event on a composite
+// resource. The rest of each message is unchanged.
+func WithResultSource(name string) ServeOption {
+	return WithResponseInterceptor(tagResults(name))
+}
+
+// WithOnStart adds a function that is called before the Function starts
+// serving RunFunctionRequests. Use it to set up resources the Function needs,
+// for example to open a database connection. If it returns an error the
+// Function doesn't start, and Serve returns the error. This option may be
+// supplied multiple times. OnStart hooks run in the order they were supplied.
+func WithOnStart(fn func() error) ServeOption {
+	return func(o *ServeOptions) error {
+		o.OnStart = append(o.OnStart, fn)
+		return nil
+	}
+}
+
+// WithOnStop adds a function that is called after the Function stops serving
+// RunFunctionRequests. Use it to clean up resources set up by an OnStart hook.
+// OnStop hooks aren't called if the Function doesn't start. This option may be
+// supplied multiple times. OnStop hooks run in the reverse of the order they
+// were supplied, like deferred function calls.
+func WithOnStop(fn func()) ServeOption {
+	return func(o *ServeOptions) error {
+		o.OnStop = append(o.OnStop, fn)
+		return nil
+	}
+}
+
+// WithReadiness configures the Function's gRPC health service to report that
+// it is not serving until the supplied channel is closed. Use it to avoid
+// receiving requests while the Function warms up - for example while it loads
+// configuration or connects to external systems. Without this option the
+// health service reports that the Function is serving as soon as it starts.
+func WithReadiness(ready <-chan struct{}) ServeOption {
+	return func(o *ServeOptions) error {
+		o.Ready = ready
+		return nil
+	}
+}
+
+// WithMaxConnectionAge configures the maximum amount of time a connection may
+// exist before the server gracefully closes it, forcing the client to
+// reconnect. Reconnecting clients perform a new TLS handshake, so this ensures
+// that rotated TLS certificates (e.g. those managed by cert-manager) are
+// eventually used by all connections. There is no limit by default.
+func WithMaxConnectionAge(d time.Duration) ServeOption {
+	return func(o *ServeOptions) error {
+		if d < 0 {
+			return errors.Errorf("maximum connection age must not be negative, got %s", d)
+		}
+		o.MaxConnectionAge = d
+		return nil
+	}
+}
+
+// WithContextGuard skips running the Function when a RunFunctionRequest's
+// context is already canceled or past its deadline when the request arrives.
+// Crossplane discards the response to such a request, so the Function's work
+// would be wasted. Instead the request's desired state is returned unchanged,
+// with a zero TTL and a warning result. The context guard is disabled by
+// default.
+func WithContextGuard() ServeOption {
+	return func(o *ServeOptions) error {
+		o.ContextGuard = true
+		return nil
+	}
+}
+
+// WithDebug preserves the debugging artifacts recorded by response.SetDebug in
+// RunFunctionResponses. Only use it in development, for example when rendering
+// a Composition locally. Debugging artifacts are stripped by default.
+func WithDebug() ServeOption {
+	return func(o *ServeOptions) error {
+		o.Debug = true
+		return nil
+	}
+}
+
 // Serve the supplied Function by creating a gRPC server and listening for
-// RunFunctionRequests. Blocks until the server returns an error.
+// RunFunctionRequests. Blocks until the server returns an error, or until the
+// process receives SIGTERM or an interrupt, in which case the server is
+// gracefully stopped.
 func Serve(fn v1beta1.FunctionRunnerServiceServer, o ...ServeOption) error {
+	s, err := NewServer(fn, o...)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		// Stop only returns an error if its context is done before the server
+		// stops gracefully, and this context never is.
+		_ = s.Stop(context.Background())
+	}()
+
+	return s.Start()
+}
+
+// A Server serves a Function. Unlike Serve, a Server can be stopped, which
+// makes it useful for testing a Function end-to-end.
+type Server struct {
+	lis net.Listener
+	srv *grpc.Server
+
+	onStart []func() error
+	onStop  []func()
+}
+
+// NewServer returns a Server for the supplied Function. The Server listens for
+// connections immediately, but doesn't serve RunFunctionRequests until it is
+// started.
+func NewServer(fn v1beta1.FunctionRunnerServiceServer, o ...ServeOption) (*Server, error) {
 	so := &ServeOptions{
 		Network: DefaultNetwork,
 		Address: DefaultAddress,
+		Logger:  logging.NewNopLogger(),
 	}
 
 	for _, fn := range o {
 		if err := fn(so); err != nil {
-			return errors.Wrap(err, "cannot apply ServeOption")
+			return nil, errors.Wrap(err, "cannot apply ServeOption")
 		}
 	}
 
 	if so.Credentials == nil {
-		return errors.New("no credentials provided - did you specify the Insecure or MTLSCertificates options?")
+		return nil, errors.New("no credentials provided - did you specify the Insecure or MTLSCertificates options?")
 	}
 
 	lis, err := net.Listen(so.Network, so.Address)
 	if err != nil {
-		return errors.Wrapf(err, "cannot listen for %s connections at address %q", so.Network, so.Address)
+		return nil, errors.Wrapf(err, "cannot listen for %s connections at address %q", so.Network, so.Address)
+	}
+
+	interceptors := make([]grpc.UnaryServerInterceptor, 0, len(so.UnaryInterceptors)+7)
+	interceptors = append(interceptors, so.UnaryInterceptors...)
+	interceptors = append(interceptors, statusErrors, requestContext(so.Logger))
+	if len(so.ResponseInterceptors) > 0 {
+		interceptors = append(interceptors, interceptResponses(so.ResponseInterceptors...))
+	}
+	if so.ContextGuard {
+		interceptors = append(interceptors, contextGuard)
+	}
+	if !so.Debug {
+		interceptors = append(interceptors, stripDebug)
+	}
+	if so.Compression {
+		interceptors = append(interceptors, compressResponses)
+	}
+	if so.MaxDesiredResources > 0 {
+		interceptors = append(interceptors, maxDesiredResources(so.MaxDesiredResources))
 	}
 
-	srv := grpc.NewServer(grpc.Creds(so.Credentials))
+	sopts := []grpc.ServerOption{grpc.Creds(so.Credentials), grpc.ChainUnaryInterceptor(interceptors...)}
+	if so.MaxConnectionAge > 0 {
+		sopts = append(sopts, grpc.KeepaliveParams(keepalive.ServerParameters{MaxConnectionAge: so.MaxConnectionAge}))
+	}
+
+	srv := grpc.NewServer(sopts...)
 	reflection.Register(srv)
 	v1beta1.RegisterFunctionRunnerServiceServer(srv, fn)
-	return errors.Wrap(srv.Serve(lis), "cannot serve mTLS gRPC connections")
+
+	hs := health.NewServer()
+	if so.Ready != nil {
+		hs.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+		go func() {
+			<-so.Ready
+			hs.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+		}()
+	}
+	healthpb.RegisterHealthServer(srv, hs)
+
+	return &Server{lis: lis, srv: srv, onStart: so.OnStart, onStop: so.OnStop}, nil
+}
+
+// Addr returns the address the Server is listening on. This is useful when the
+// Server was configured to listen on port zero, i.e. on a random free port.
+func (s *Server) Addr() net.Addr {
+	return s.lis.Addr()
+}
+
+// Start serving RunFunctionRequests. Blocks until the Server is stopped, or
+// returns an error. Any OnStart hooks are run before the Server starts serving,
+// and any OnStop hooks are run after it stops.
+func (s *Server) Start() error {
+	for _, fn := range s.onStart {
+		if err := fn(); err != nil {
+			_ = s.lis.Close()
+			return errors.Wrap(err, "OnStart hook failed")
+		}
+	}
+	defer func() {
+		for i := len(s.onStop) - 1; i >= 0; i-- {
+			s.onStop[i]()
+		}
+	}()
+	return errors.Wrap(s.srv.Serve(s.lis), "cannot serve mTLS gRPC connections")
+}
+
+// Stop the Server gracefully, waiting for in-flight RunFunctionRequests to
+// complete. If the supplied context is done before they complete the Server is
+// stopped immediately, and the context's error is returned.
+func (s *Server) Stop(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		s.srv.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.srv.Stop()
+		return ctx.Err()
+	}
+}
+
+// maxDesiredResources returns a gRPC interceptor that replaces any
+// RunFunctionResponse with more than n desired composed resources with a fatal
+// result.
+func maxDesiredResources(n int) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		rsp, err := handler(ctx, req)
+		if err != nil {
+			return rsp, err
+		}
+		frsp, ok := rsp.(*v1beta1.RunFunctionResponse)
+		if !ok {
+			return rsp, nil
+		}
+		if got := len(frsp.GetDesired().GetResources()); got > n {
+			// Return the desired state we were sent, rather than the
+			// (potentially huge) desired state the Function produced.
+			if freq, ok := req.(*v1beta1.RunFunctionRequest); ok {
+				frsp.Desired = freq.GetDesired()
+			}
+			response.Fatal(frsp, errors.Errorf("function returned %d desired composed resources, exceeding the maximum of %d", got, n))
+		}
+		return frsp, nil
+	}
+}
+
+// interceptResponses returns a gRPC interceptor that calls the supplied
+// functions, in order, with every successful RunFunctionResponse.
+func interceptResponses(fns ...func(rsp *v1beta1.RunFunctionResponse)) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		rsp, err := handler(ctx, req)
+		if err != nil {
+			return rsp, err
+		}
+		frsp, ok := rsp.(*v1beta1.RunFunctionResponse)
+		if !ok {
+			return rsp, nil
+		}
+		for _, fn := range fns {
+			fn(frsp)
+		}
+		return frsp, nil
+	}
+}
+
+// tagResults returns a response interceptor that prefixes the message of every
+// result with the supplied name. Structured result data is linked to its result
+// by message, so the message of any result data entry that matches one of the
+// response's results is prefixed too. Entries recorded by earlier Functions in
+// the pipeline are left as is.
+func tagResults(name string) func(rsp *v1beta1.RunFunctionResponse) {
+	prefix := "[" + name + "] "
+	return func(rsp *v1beta1.RunFunctionResponse) {
+		messages := make(map[string]bool, len(rsp.GetResults()))
+		for _, r := range rsp.GetResults() {
+			messages[r.GetMessage()] = true
+			r.Message = prefix + r.GetMessage()
+		}
+		for _, e := range rsp.GetContext().GetFields()[fncontext.KeyResultData].GetListValue().GetValues() {
+			f := e.GetStructValue().GetFields()
+			if m := f["message"].GetStringValue(); messages[m] {
+				f["message"] = structpb.NewStringValue(prefix + m)
+			}
+		}
+	}
+}
+
+// contextGuard is a gRPC interceptor that doesn't run the handler if the
+// request's context is already done. It instead returns the request's desired
+// state with a zero TTL and a warning result.
+func contextGuard(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	freq, ok := req.(*v1beta1.RunFunctionRequest)
+	if !ok || ctx.Err() == nil {
+		return handler(ctx, req)
+	}
+	rsp := response.To(freq, 0)
+	response.Warning(rsp, errors.Wrap(ctx.Err(), "skipped running function"))
+	return rsp, nil
+}
+
+// stripDebug is a gRPC interceptor that removes debugging artifacts from
+// responses.
+func stripDebug(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	rsp, err := handler(ctx, req)
+	if frsp, ok := rsp.(*v1beta1.RunFunctionResponse); ok {
+		delete(frsp.GetContext().GetFields(), fncontext.KeyDebug)
+	}
+	return rsp, err
+}
+
+// StatusError returns an error that will be returned to Crossplane as a gRPC
+// status with the supplied code. It returns nil if the supplied error is nil.
+//
+// A Function should only return an error from RunFunction when the Function
+// itself fails - for example because it can't reach a dependency it needs to
+// run. Use StatusError to tell Crossplane why, for example by returning
+// codes.Unavailable. When the Function runs successfully but can't produce the
+// desired state - for example because of invalid input - it should instead
+// return a response with a fatal result. See response.Fatal.
+//
+// The status carries only the supplied code and the error's message. Status
+// details can't be attached to it.
+func StatusError(code codes.Code, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &statusError{code: code, err: err}
+}
+
+type statusError struct {
+	code codes.Code
+	err  error
+}
+
+func (e *statusError) Error() string {
+	return e.err.Error()
+}
+
+func (e *statusError) Unwrap() error {
+	return e.err
+}
+
+func (e *statusError) GRPCStatus() *status.Status {
+	return status.New(e.code, e.err.Error())
+}
+
+// statusErrors is a gRPC interceptor that converts errors returned by
+// RunFunction to gRPC statuses. Errors returned by StatusError keep their code.
+// Context errors are converted to the corresponding code. All other errors are
+// considered internal errors.
+func statusErrors(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	rsp, err := handler(ctx, req)
+	if err == nil {
+		return rsp, nil
+	}
+	if s, ok := status.FromError(err); ok {
+		return rsp, s.Err()
+	}
+	if s := status.FromContextError(err); s.Code() != codes.Unknown {
+		return rsp, s.Err()
+	}
+	return rsp, status.Error(codes.Internal, err.Error())
+}
+
+// compressResponses is a gRPC interceptor that compresses responses using gzip,
+// if the client supports it.
+func compressResponses(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	supported, _ := grpc.ClientSupportedCompressors(ctx)
+	for _, c := range supported {
+		if c != gzip.Name {
+			continue
+		}
+		if err := grpc.SetSendCompressor(ctx, gzip.Name); err != nil {
+			return nil, errors.Wrap(err, "cannot set gzip response compressor")
+		}
+		break
+	}
+	return handler(ctx, req)
 }
 
-// NewLogger returns a new logger.
+// NewLogger returns a new logger. Debug loggers emit human-readable console
+// output including debug messages, while others emit structured JSON.
 func NewLogger(debug bool) (logging.Logger, error) {
-	return logging.NewLogger(debug)
+	if debug {
+		return logging.NewLogger(logging.Console(), logging.Level(1))
+	}
+	return logging.NewLogger(logging.JSON())
 }
@@ -17,10 +17,34 @@ limitations under the License.
 package function
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
 
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
 
+	"github.com/crossplane/function-sdk-go/logging"
 	"github.com/crossplane/function-sdk-go/proto/v1beta1"
 	"github.com/crossplane/function-sdk-go/request"
 	"github.com/crossplane/function-sdk-go/resource"
@@ -78,3 +102,680 @@ func Example() {
 	// Output:
 	// {"meta":{"ttl":"60s"},"desired":{"resources":{"new":{"resource":{"apiVersion":"example.org/v1","kind":"CoolResource","metadata":{"labels":{"coolness":"high"}},"spec":{"widgets":9001}}}}}}
 }
+
+func TestMaxDesiredResources(t *testing.T) {
+	type args struct {
+		n   int
+		req *v1beta1.RunFunctionRequest
+		rsp *v1beta1.RunFunctionResponse
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   *v1beta1.RunFunctionResponse
+	}{
+		"WithinLimit": {
+			reason: "A response within the limit should be returned unchanged.",
+			args: args{
+				n:   1,
+				req: &v1beta1.RunFunctionRequest{},
+				rsp: &v1beta1.RunFunctionResponse{
+					Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{"a": {}}},
+				},
+			},
+			want: &v1beta1.RunFunctionResponse{
+				Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{"a": {}}},
+			},
+		},
+		"ExceedsLimit": {
+			reason: "A response exceeding the limit should have its desired state reset, and a fatal result.",
+			args: args{
+				n: 1,
+				req: &v1beta1.RunFunctionRequest{
+					Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{"a": {}}},
+				},
+				rsp: &v1beta1.RunFunctionResponse{
+					Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{"a": {}, "b": {}}},
+				},
+			},
+			want: &v1beta1.RunFunctionResponse{
+				Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{"a": {}}},
+				Results: []*v1beta1.Result{{
+					Severity: v1beta1.Severity_SEVERITY_FATAL,
+					Message:  "function returned 2 desired composed resources, exceeding the maximum of 1",
+				}},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			handler := func(_ context.Context, _ any) (any, error) { return tc.args.rsp, nil }
+			got, err := maxDesiredResources(tc.args.n)(context.Background(), tc.args.req, &grpc.UnaryServerInfo{}, handler)
+			if err != nil {
+				t.Fatalf("\n%s\nmaxDesiredResources(...): unexpected error: %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want, got, protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\nmaxDesiredResources(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRequestContext(t *testing.T) {
+	req := &v1beta1.RunFunctionRequest{Meta: &v1beta1.RequestMeta{Tag: "cool-tag"}}
+
+	var got *Context
+	handler := func(ctx context.Context, _ any) (any, error) {
+		got = CtxFrom(ctx)
+		return &v1beta1.RunFunctionResponse{}, nil
+	}
+	if _, err := requestContext(logging.NewNopLogger())(context.Background(), req, &grpc.UnaryServerInfo{}, handler); err != nil {
+		t.Fatalf("requestContext(...): unexpected error: %v", err)
+	}
+
+	if diff := cmp.Diff("cool-tag", got.Tag); diff != "" {
+		t.Errorf("CtxFrom(...).Tag: -want, +got:\n%s", diff)
+	}
+	if got.Log == nil {
+		t.Errorf("CtxFrom(...).Log: want a logger, got nil")
+	}
+}
+
+func TestContextGuard(t *testing.T) {
+	req := &v1beta1.RunFunctionRequest{
+		Meta:    &v1beta1.RequestMeta{Tag: "cool-tag"},
+		Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{"a": {}}},
+	}
+	handled := &v1beta1.RunFunctionResponse{Meta: &v1beta1.ResponseMeta{Tag: "handled"}}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cases := map[string]struct {
+		reason string
+		ctx    context.Context
+		want   *v1beta1.RunFunctionResponse
+	}{
+		"ContextNotDone": {
+			reason: "The handler should run if the context isn't done.",
+			ctx:    context.Background(),
+			want:   handled,
+		},
+		"ContextDone": {
+			reason: "The handler shouldn't run if the context is done.",
+			ctx:    canceled,
+			want: &v1beta1.RunFunctionResponse{
+				Meta:    &v1beta1.ResponseMeta{Tag: "cool-tag", Ttl: durationpb.New(0)},
+				Desired: &v1beta1.State{Resources: map[string]*v1beta1.Resource{"a": {}}},
+				Results: []*v1beta1.Result{{
+					Severity: v1beta1.Severity_SEVERITY_WARNING,
+					Message:  "skipped running function: context canceled",
+				}},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			handler := func(_ context.Context, _ any) (any, error) { return handled, nil }
+			got, err := contextGuard(tc.ctx, req, &grpc.UnaryServerInfo{}, handler)
+			if err != nil {
+				t.Fatalf("\n%s\ncontextGuard(...): unexpected error: %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want, got, protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\ncontextGuard(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestInterceptResponses(t *testing.T) {
+	first := func(rsp *v1beta1.RunFunctionResponse) { response.Normal(rsp, "first") }
+	second := func(rsp *v1beta1.RunFunctionResponse) { response.Normal(rsp, "second") }
+
+	cases := map[string]struct {
+		reason string
+		err    error
+		want   *v1beta1.RunFunctionResponse
+	}{
+		"Success": {
+			reason: "Response interceptors should run in order on successful responses.",
+			want: &v1beta1.RunFunctionResponse{Results: []*v1beta1.Result{
+				{Severity: v1beta1.Severity_SEVERITY_NORMAL, Message: "first"},
+				{Severity: v1beta1.Severity_SEVERITY_NORMAL, Message: "second"},
+			}},
+		},
+		"Error": {
+			reason: "Response interceptors shouldn't run if the handler returns an error.",
+			err:    errors.New("boom"),
+			want:   &v1beta1.RunFunctionResponse{},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			handler := func(_ context.Context, _ any) (any, error) { return &v1beta1.RunFunctionResponse{}, tc.err }
+			got, _ := interceptResponses(first, second)(context.Background(), &v1beta1.RunFunctionRequest{}, &grpc.UnaryServerInfo{}, handler)
+			if diff := cmp.Diff(tc.want, got, protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\ninterceptResponses(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestTagResults(t *testing.T) {
+	rsp := &v1beta1.RunFunctionResponse{}
+	response.Normal(rsp, "created bucket")
+	response.Warning(rsp, errors.New("bucket is public"))
+
+	tagResults("function-example")(rsp)
+
+	want := &v1beta1.RunFunctionResponse{Results: []*v1beta1.Result{
+		{Severity: v1beta1.Severity_SEVERITY_NORMAL, Message: "[function-example] created bucket"},
+		{Severity: v1beta1.Severity_SEVERITY_WARNING, Message: "[function-example] bucket is public"},
+	}}
+	if diff := cmp.Diff(want, rsp, protocmp.Transform()); diff != "" {
+		t.Errorf("tagResults(...): -want, +got:\n%s", diff)
+	}
+}
+
+type dataReporter struct {
+	v1beta1.UnimplementedFunctionRunnerServiceServer
+}
+
+func (r *dataReporter) RunFunction(_ context.Context, req *v1beta1.RunFunctionRequest) (*v1beta1.RunFunctionResponse, error) {
+	rsp := response.To(req, response.DefaultTTL)
+	if err := response.NormalWithData(rsp, "created bucket", map[string]any{"buckets": 1}); err != nil {
+		return nil, err
+	}
+	return rsp, nil
+}
+
+func TestWithResultSource(t *testing.T) {
+	conn := startServer(t, &dataReporter{}, WithResultSource("function-example"))
+
+	// The request's context carries result data recorded by an earlier
+	// Function in the pipeline, which shouldn't be tagged.
+	req := &v1beta1.RunFunctionRequest{
+		Context: resource.MustStructJSON(`{
+			"function-sdk-go.crossplane.io/result-data": [
+				{"message": "[function-earlier] created bucket", "data": {"buckets": 2}}
+			]
+		}`),
+	}
+	rsp, err := v1beta1.NewFunctionRunnerServiceClient(conn).RunFunction(context.Background(), req)
+	if err != nil {
+		t.Fatalf("RunFunction(...): unexpected error: %v", err)
+	}
+
+	want := &v1beta1.RunFunctionResponse{
+		Meta: &v1beta1.ResponseMeta{Ttl: durationpb.New(response.DefaultTTL)},
+		Results: []*v1beta1.Result{
+			{Severity: v1beta1.Severity_SEVERITY_NORMAL, Message: "[function-example] created bucket"},
+		},
+		Context: resource.MustStructJSON(`{
+			"function-sdk-go.crossplane.io/result-data": [
+				{"message": "[function-earlier] created bucket", "data": {"buckets": 2}},
+				{"message": "[function-example] created bucket", "data": {"buckets": 1}}
+			]
+		}`),
+	}
+	if diff := cmp.Diff(want, rsp, protocmp.Transform()); diff != "" {
+		t.Errorf("RunFunction(...): result data should be linked to its tagged result: -want, +got:\n%s", diff)
+	}
+}
+
+func TestStripDebug(t *testing.T) {
+	rsp := &v1beta1.RunFunctionResponse{}
+	response.SetContextKey(rsp, "keep", structpb.NewStringValue("me"))
+	_ = response.SetDebug(rsp, "template", "rendered")
+
+	handler := func(_ context.Context, _ any) (any, error) { return rsp, nil }
+	got, err := stripDebug(context.Background(), &v1beta1.RunFunctionRequest{}, &grpc.UnaryServerInfo{}, handler)
+	if err != nil {
+		t.Fatalf("stripDebug(...): unexpected error: %v", err)
+	}
+
+	want := &v1beta1.RunFunctionResponse{
+		Context: &structpb.Struct{Fields: map[string]*structpb.Value{"keep": structpb.NewStringValue("me")}},
+	}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("stripDebug(...): -want, +got:\n%s", diff)
+	}
+}
+
+func TestCallerFrom(t *testing.T) {
+	type want struct {
+		c  Caller
+		ok bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		ctx    context.Context
+		want   want
+	}{
+		"NoPeer": {
+			reason: "We should return false if the context doesn't carry connection information.",
+			ctx:    context.Background(),
+		},
+		"Insecure": {
+			reason: "We should return the caller's address if the connection isn't authenticated.",
+			ctx:    peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 4242}}),
+			want:   want{c: Caller{Address: "10.0.0.1:4242"}, ok: true},
+		},
+		"MTLS": {
+			reason: "We should return the caller's address and certificate common name if the connection uses mTLS.",
+			ctx: peer.NewContext(context.Background(), &peer.Peer{
+				Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 4242},
+				AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{
+					PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "crossplane"}}},
+				}},
+			}),
+			want: want{c: Caller{Address: "10.0.0.1:4242", CommonName: "crossplane"}, ok: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c, ok := CallerFrom(tc.ctx)
+			if diff := cmp.Diff(tc.want.c, c); diff != "" {
+				t.Errorf("\n%s\nCallerFrom(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.ok, ok); diff != "" {
+				t.Errorf("\n%s\nCallerFrom(...): -want ok, +got ok:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestContextRemaining(t *testing.T) {
+	withDeadline, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Minute))
+	defer cancel()
+
+	type want struct {
+		min time.Duration
+		max time.Duration
+		ok  bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		ctx    context.Context
+		want   want
+	}{
+		"NoDeadline": {
+			reason: "We should return false if the context has no deadline.",
+			ctx:    context.Background(),
+		},
+		"Deadline": {
+			reason: "We should return how long remains until the context's deadline.",
+			ctx:    withDeadline,
+			want:   want{min: 0, max: time.Minute, ok: true},
+		},
+		"Expired": {
+			reason: "We should return a negative duration if the context's deadline has passed.",
+			ctx:    expired,
+			want:   want{min: -2 * time.Minute, max: -time.Minute, ok: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			d, ok := CtxFrom(tc.ctx).Remaining()
+			if d < tc.want.min || d > tc.want.max {
+				t.Errorf("\n%s\nRemaining(): want between %s and %s, got %s", tc.reason, tc.want.min, tc.want.max, d)
+			}
+			if diff := cmp.Diff(tc.want.ok, ok); diff != "" {
+				t.Errorf("\n%s\nRemaining(): -want ok, +got ok:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestStatusErrors(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		err    error
+		want   error
+	}{
+		"NoError": {
+			reason: "No error should be returned if the handler succeeds.",
+		},
+		"StatusError": {
+			reason: "Errors returned by StatusError should keep their code.",
+			err:    StatusError(codes.Unavailable, errors.New("boom")),
+			want:   status.Error(codes.Unavailable, "boom"),
+		},
+		"ContextError": {
+			reason: "Context errors should be converted to their corresponding code.",
+			err:    context.DeadlineExceeded,
+			want:   status.Error(codes.DeadlineExceeded, context.DeadlineExceeded.Error()),
+		},
+		"OtherError": {
+			reason: "Other errors should be considered internal errors.",
+			err:    errors.New("boom"),
+			want:   status.Error(codes.Internal, "boom"),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			handler := func(_ context.Context, _ any) (any, error) { return &v1beta1.RunFunctionResponse{}, tc.err }
+			_, err := statusErrors(context.Background(), &v1beta1.RunFunctionRequest{}, &grpc.UnaryServerInfo{}, handler)
+			if diff := cmp.Diff(status.Convert(tc.want).Proto(), status.Convert(err).Proto(), protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\nstatusErrors(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+type echo struct {
+	v1beta1.UnimplementedFunctionRunnerServiceServer
+}
+
+func (e *echo) RunFunction(_ context.Context, req *v1beta1.RunFunctionRequest) (*v1beta1.RunFunctionResponse, error) {
+	return response.To(req, response.DefaultTTL), nil
+}
+
+func TestServer(t *testing.T) {
+	s, err := NewServer(&echo{}, Listen("tcp", "127.0.0.1:0"), Insecure(true))
+	if err != nil {
+		t.Fatalf("NewServer(...): unexpected error: %v", err)
+	}
+
+	started := make(chan error)
+	go func() { started <- s.Start() }()
+
+	conn, err := grpc.Dial(s.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("grpc.Dial(...): unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	req := &v1beta1.RunFunctionRequest{Meta: &v1beta1.RequestMeta{Tag: "cool-tag"}}
+	rsp, err := v1beta1.NewFunctionRunnerServiceClient(conn).RunFunction(context.Background(), req)
+	if err != nil {
+		t.Fatalf("RunFunction(...): unexpected error: %v", err)
+	}
+	if diff := cmp.Diff("cool-tag", rsp.GetMeta().GetTag()); diff != "" {
+		t.Errorf("RunFunction(...): -want tag, +got tag:\n%s", diff)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.Stop(ctx); err != nil {
+		t.Errorf("Stop(...): unexpected error: %v", err)
+	}
+	if err := <-started; err != nil {
+		t.Errorf("Start(): unexpected error: %v", err)
+	}
+}
+
+func TestServerHooks(t *testing.T) {
+	t.Run("OnStartError", func(t *testing.T) {
+		stopped := false
+		s, err := NewServer(&echo{}, Listen("tcp", "127.0.0.1:0"), Insecure(true),
+			WithOnStart(func() error { return errors.New("boom") }),
+			WithOnStop(func() { stopped = true }),
+		)
+		if err != nil {
+			t.Fatalf("NewServer(...): unexpected error: %v", err)
+		}
+		if err := s.Start(); err == nil {
+			t.Errorf("Start(): expected an error from the OnStart hook")
+		}
+		if stopped {
+			t.Errorf("Start(): OnStop hooks shouldn't run if the Server doesn't start")
+		}
+	})
+
+	t.Run("Lifecycle", func(t *testing.T) {
+		var mu sync.Mutex
+		calls := []string{}
+		record := func(call string) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls = append(calls, call)
+		}
+
+		s, err := NewServer(&echo{}, Listen("tcp", "127.0.0.1:0"), Insecure(true),
+			WithOnStart(func() error { record("start-1"); return nil }),
+			WithOnStart(func() error { record("start-2"); return nil }),
+			WithOnStop(func() { record("stop-1") }),
+			WithOnStop(func() { record("stop-2") }),
+		)
+		if err != nil {
+			t.Fatalf("NewServer(...): unexpected error: %v", err)
+		}
+
+		started := make(chan error)
+		go func() { started <- s.Start() }()
+
+		conn, err := grpc.Dial(s.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			t.Fatalf("grpc.Dial(...): unexpected error: %v", err)
+		}
+		defer conn.Close()
+		if _, err := v1beta1.NewFunctionRunnerServiceClient(conn).RunFunction(context.Background(), &v1beta1.RunFunctionRequest{}); err != nil {
+			t.Fatalf("RunFunction(...): unexpected error: %v", err)
+		}
+		record("run")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := s.Stop(ctx); err != nil {
+			t.Errorf("Stop(...): unexpected error: %v", err)
+		}
+		if err := <-started; err != nil {
+			t.Errorf("Start(): unexpected error: %v", err)
+		}
+
+		want := []string{"start-1", "start-2", "run", "stop-2", "stop-1"}
+		if diff := cmp.Diff(want, calls); diff != "" {
+			t.Errorf("Start(): -want hook calls, +got hook calls:\n%s", diff)
+		}
+	})
+}
+
+// startServer starts a Server for the supplied Function, and returns a client
+// connection to it. The Server is stopped when the test finishes.
+func startServer(t *testing.T, fn v1beta1.FunctionRunnerServiceServer, o ...ServeOption) *grpc.ClientConn {
+	t.Helper()
+
+	s, err := NewServer(fn, append([]ServeOption{Listen("tcp", "127.0.0.1:0"), Insecure(true)}, o...)...)
+	if err != nil {
+		t.Fatalf("NewServer(...): unexpected error: %v", err)
+	}
+	started := make(chan error)
+	go func() { started <- s.Start() }()
+
+	conn, err := grpc.Dial(s.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("grpc.Dial(...): unexpected error: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = conn.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := s.Stop(ctx); err != nil {
+			t.Errorf("Stop(...): unexpected error: %v", err)
+		}
+		if err := <-started; err != nil {
+			t.Errorf("Start(): unexpected error: %v", err)
+		}
+	})
+
+	return conn
+}
+
+func TestWithReadiness(t *testing.T) {
+	ready := make(chan struct{})
+	hc := healthpb.NewHealthClient(startServer(t, &echo{}, WithReadiness(ready)))
+
+	rsp, err := hc.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Check(...): unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(healthpb.HealthCheckResponse_NOT_SERVING, rsp.GetStatus()); diff != "" {
+		t.Errorf("Check(...): the Function shouldn't be serving before it's ready: -want, +got:\n%s", diff)
+	}
+
+	close(ready)
+
+	// The health service is updated asynchronously once ready is closed.
+	got := rsp.GetStatus()
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		rsp, err := hc.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		if err != nil {
+			t.Fatalf("Check(...): unexpected error: %v", err)
+		}
+		if got = rsp.GetStatus(); got == healthpb.HealthCheckResponse_SERVING {
+			break
+		}
+	}
+	if diff := cmp.Diff(healthpb.HealthCheckResponse_SERVING, got); diff != "" {
+		t.Errorf("Check(...): the Function should be serving once it's ready: -want, +got:\n%s", diff)
+	}
+}
+
+type tagRecorder struct {
+	v1beta1.UnimplementedFunctionRunnerServiceServer
+
+	record func(call string)
+}
+
+func (r *tagRecorder) RunFunction(ctx context.Context, req *v1beta1.RunFunctionRequest) (*v1beta1.RunFunctionResponse, error) {
+	r.record("fn:" + CtxFrom(ctx).Tag)
+	return response.To(req, response.DefaultTTL), nil
+}
+
+func TestWithUnaryInterceptor(t *testing.T) {
+	calls := []string{}
+	record := func(call string) { calls = append(calls, call) }
+
+	// Interceptors record the tag available via CtxFrom. It's only available
+	// once the SDK's own interceptors have run.
+	interceptor := func(name string) grpc.UnaryServerInterceptor {
+		return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			record(name + ":" + CtxFrom(ctx).Tag)
+			return handler(ctx, req)
+		}
+	}
+
+	conn := startServer(t, &tagRecorder{record: record},
+		WithUnaryInterceptor(interceptor("first")),
+		WithUnaryInterceptor(interceptor("second")),
+	)
+
+	req := &v1beta1.RunFunctionRequest{Meta: &v1beta1.RequestMeta{Tag: "cool-tag"}}
+	if _, err := v1beta1.NewFunctionRunnerServiceClient(conn).RunFunction(context.Background(), req); err != nil {
+		t.Fatalf("RunFunction(...): unexpected error: %v", err)
+	}
+
+	want := []string{"first:", "second:", "fn:cool-tag"}
+	if diff := cmp.Diff(want, calls); diff != "" {
+		t.Errorf("RunFunction(...): -want calls, +got calls:\n%s", diff)
+	}
+}
+
+// compressionRecorder is a gRPC stats handler that records the compression
+// algorithm of the response headers a client receives.
+type compressionRecorder struct {
+	mu          sync.Mutex
+	compression string
+}
+
+func (r *compressionRecorder) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (r *compressionRecorder) HandleRPC(_ context.Context, s stats.RPCStats) {
+	if h, ok := s.(*stats.InHeader); ok {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.compression = h.Compression
+	}
+}
+
+func (r *compressionRecorder) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (r *compressionRecorder) HandleConn(_ context.Context, _ stats.ConnStats) {}
+
+func TestWithCompression(t *testing.T) {
+	s, err := NewServer(&echo{}, Listen("tcp", "127.0.0.1:0"), Insecure(true), WithCompression())
+	if err != nil {
+		t.Fatalf("NewServer(...): unexpected error: %v", err)
+	}
+	started := make(chan error)
+	go func() { started <- s.Start() }()
+
+	// The client advertises support for gzip because the gzip package is
+	// imported, but doesn't compress its requests. The server would otherwise
+	// compress its responses only if the client compressed its requests.
+	cr := &compressionRecorder{}
+	conn, err := grpc.Dial(s.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(cr),
+	)
+	if err != nil {
+		t.Fatalf("grpc.Dial(...): unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	req := &v1beta1.RunFunctionRequest{
+		Meta:    &v1beta1.RequestMeta{Tag: "cool-tag"},
+		Desired: &v1beta1.State{Composite: &v1beta1.Resource{Resource: resource.MustStructJSON(`{"status":{"widgets":9001}}`)}},
+	}
+	rsp, err := v1beta1.NewFunctionRunnerServiceClient(conn).RunFunction(context.Background(), req)
+	if err != nil {
+		t.Fatalf("RunFunction(...): unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(req.GetDesired(), rsp.GetDesired(), protocmp.Transform()); diff != "" {
+		t.Errorf("RunFunction(...): -want desired, +got desired:\n%s", diff)
+	}
+
+	cr.mu.Lock()
+	got := cr.compression
+	cr.mu.Unlock()
+	if diff := cmp.Diff(gzip.Name, got); diff != "" {
+		t.Errorf("RunFunction(...): the response should be compressed: -want, +got:\n%s", diff)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.Stop(ctx); err != nil {
+		t.Errorf("Stop(...): unexpected error: %v", err)
+	}
+	if err := <-started; err != nil {
+		t.Errorf("Start(): unexpected error: %v", err)
+	}
+}
+
+func TestWithMaxConnectionAge(t *testing.T) {
+	if _, err := NewServer(&echo{}, Listen("tcp", "127.0.0.1:0"), Insecure(true), WithMaxConnectionAge(-time.Second)); err == nil {
+		t.Errorf("NewServer(...): expected an error for a negative maximum connection age")
+	}
+
+	conn := startServer(t, &echo{}, WithMaxConnectionAge(100*time.Millisecond))
+	if _, err := v1beta1.NewFunctionRunnerServiceClient(conn).RunFunction(context.Background(), &v1beta1.RunFunctionRequest{}); err != nil {
+		t.Fatalf("RunFunction(...): unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(connectivity.Ready, conn.GetState()); diff != "" {
+		t.Fatalf("GetState(): -want, +got:\n%s", diff)
+	}
+
+	// The server should close the connection once it reaches its maximum age.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if !conn.WaitForStateChange(ctx, connectivity.Ready) {
+		t.Errorf("WaitForStateChange(...): the server should close connections older than the maximum connection age")
+	}
+}